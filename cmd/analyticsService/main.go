@@ -1,119 +1,96 @@
 package main
 
 import (
+	"context"
+	"log"
+	"time"
+
+	"Go-internship-Manifure/internal/app"
+	"Go-internship-Manifure/internal/config"
 	"Go-internship-Manifure/internal/db/analytics_db"
 	"Go-internship-Manifure/internal/handlers/analytics"
+	"Go-internship-Manifure/internal/health"
 	"Go-internship-Manifure/internal/kafka"
-	"Go-internship-Manifure/internal/monitoring"
-	"context"
-	"log"
-	"net/http"
-	"os"
-	"os/signal"
-	"strings"
-	"syscall"
 )
 
 func main() {
-	monitoring.Init()
+	defaults := config.Default()
+	defaults.HTTP.Addr = ":8083"
+	// Таблицы сервиса хранятся в собственной схеме
+	defaults.Postgres.Schema = "analytics"
+	defaults.Kafka.Topics = []string{defaults.Kafka.ProductTopic, "user-updates"}
+	defaults.Kafka.ConsumerGroup = "analytics_service"
+	// Срок остановки включает обработку уже прочитанных сообщений
+	defaults.ShutdownTimeout = 30 * time.Second
+
+	a := app.New("analytics", defaults)
+	cfg := a.Config
 
-	kafkaEnv := os.Getenv("KAFKA_ADDRESS")
-	if kafkaEnv == "" {
-		kafkaEnv = "localhost:9091,localhost:9092,localhost:9093" // Значение по умолчанию
-	}
+	// Соединение с базой данных
+	var database *db.AnalyticsDatabase
 
-	host := os.Getenv("POSTGRES_HOST")
-	if host == "" {
-		host = "localhost" // Значение по умолчанию
-	}
+	a.Connect("postgres", func(ctx context.Context) (err error) {
+		database, err = db.NewAnalyticsDatabase(ctx, cfg.Postgres)
 
-	user := os.Getenv("POSTGRES_USER")
-	if user == "" {
-		user = "postgres"
-	}
+		return err
+	})
+	a.Lifecycle.OnStop("database", func(context.Context) error { return database.CloseAnalyticsDB() })
+	a.Health.Add("postgres", health.Database(database.Conn))
 
-	password := os.Getenv("POSTGRES_PASSWORD")
-	if password == "" {
-		password = "1"
-	}
+	// Миграции схемы или подкоманда migrate
+	a.Migrate(database.Migrations)
 
-	dbname := os.Getenv("POSTGRES_DB")
-	if dbname == "" {
-		dbname = "postgres"
-	}
+	// Инициализация обработчика
+	analyticsHandler := analytics.NewAnalyticsHandler(database.Conn, database.Ledger)
+	analyticsHandler.ProductTopic = cfg.Kafka.ProductTopic
 
-	port := os.Getenv("POSTGRES_PORT")
-	if port == "" {
-		port = "5432"
-	}
+	monitoredHandler := analytics.NewMonitoredHandler(analyticsHandler)
 
-	address := strings.Split(kafkaEnv, ",")
-	consumerGroup := "analytics_service"
-	topics := []string{"product-updates", "user-updates"}
+	// Очистка журнала обработанных событий
+	a.Lifecycle.Go("processed events retention", func(ctx context.Context) error {
+		database.Ledger.RunRetention(ctx, cfg.Kafka.ProcessedEventsRetention, time.Hour)
 
-	// Соединение с базой данных
-	database := db.NewAnalyticsDatabase(host, user, password, dbname, port)
+		return nil
+	})
 
-	// Инициализация обработчика
-	analyticsHandler := analytics.NewAnalyticsHandler(database.Conn)
+	// HTTP сервер для метрик, consumer останавливается раньше него
+	a.Serve()
 
-	monitoredHandler := analytics.NewMonitoredHandler(analyticsHandler)
+	// Сообщения, которые не удалось обработать, отправляются в <topic>.dlq.
+	// Отправка ждет подтверждения каждого сообщения, поэтому без задержки накопления пачки
+	deadLetterConfig := a.ProducerConfig()
+	deadLetterConfig.Linger = 0
+
+	deadLetter, err := kafka.NewProducer(cfg.Kafka.Brokers, "", deadLetterConfig)
+	if err != nil {
+		log.Fatalf("Failed to create dead letter producer: %v", err)
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	a.Lifecycle.OnStop("dead letter producer", func(context.Context) error {
+		deadLetter.Close()
 
-	// Канал для системных сигналов
-	stopChan := make(chan os.Signal, 1)
-	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
+		return nil
+	})
 
 	// настройка kafka консьюмера
-	consumer, err := kafka.NewConsumer(monitoredHandler, address, topics, consumerGroup, 1)
+	consumer, err := kafka.NewConsumer(monitoredHandler, cfg.Kafka.Brokers, cfg.Kafka.Topics, cfg.Kafka.ConsumerGroup, cfg.Kafka.Workers)
 	if err != nil {
 		log.Fatalf("Failed to create Kafka consumer: %v", err)
 	}
 
-	// Запуск kafka consumer в отдельной горутине
-	go func() {
+	consumer.DeadLetter = deadLetter
+	a.Health.Add("kafka", health.Kafka(consumer))
+
+	// Consumer останавливается первым: прекращает чтение, дожидается обработки
+	// прочитанных сообщений и фиксирует смещения перед закрытием
+	a.Lifecycle.OnStop("kafka consumer", consumer.Close)
+	a.Lifecycle.Go("kafka consumer", func(ctx context.Context) error {
 		log.Println("Starting kafka consumer")
 		consumer.Start(ctx)
-	}()
-
-	// HTTP сервер для метрик
-	metricsServer := &http.Server{
-		Addr:    ":8083",
-		Handler: monitoring.MetricsHandler(),
-	}
 
-	// Запуск HTTP сервера для метрик
-	go func() {
-		log.Println("Starting metrics server on :8083")
-		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start metrics server: %v", err)
-		}
-	}()
+		return nil
+	})
 
 	// Ожидание сигнала завершения
-	<-stopChan
-	log.Println("Shutting down gracefully...")
-
-	cancel()
-
-	// Завершение работы Kafka consumer
-	if err := consumer.Close(); err != nil {
-		log.Fatalf("Error closing kafka consumer: %v", err)
-	}
-
-	// Завершение работы базы данных
-	if err := database.CloseAnalyticsDB(); err != nil {
-		log.Fatalf("Error closing database connection: %v", err)
-	}
-
-	// Завершение работы HTTP сервера
-	log.Println("Shutting down metrics server...")
-
-	if err := metricsServer.Shutdown(ctx); err != nil {
-		log.Fatalf("Failed to shutdown metrics server: %v", err)
-	}
-
-	log.Println("Analytics service stopped gracefully")
+	a.Run()
 }
@@ -4,82 +4,104 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
-	"strings"
-	"syscall"
 	"time"
 
+	"Go-internship-Manifure/internal/app"
+	"Go-internship-Manifure/internal/auth"
+	"Go-internship-Manifure/internal/config"
+	"Go-internship-Manifure/internal/db/product_db"
 	"Go-internship-Manifure/internal/handlers/product"
+	"Go-internship-Manifure/internal/health"
 	k "Go-internship-Manifure/internal/kafka"
-	"Go-internship-Manifure/internal/monitoring"
-	"github.com/gorilla/mux"
+	"Go-internship-Manifure/internal/redis"
 )
 
-const topic = "product-updates"
-
 func main() {
-	monitoring.Init()
+	defaults := config.Default()
+	defaults.HTTP.Addr = ":8081"
+	defaults.Kafka.Topic = "product-updates"
+	defaults.Auth.JWKSURL = "http://localhost:8080/.well-known/jwks.json"
 
-	kafkaEnv := os.Getenv("KAFKA_ADDRESS")
-	if kafkaEnv == "" {
-		kafkaEnv = "localhost:9091,localhost:9092,localhost:9093" // Значение по умолчанию
-	}
+	a := app.New("product", defaults)
+	cfg := a.Config
+
+	// Подключение к базе данных
+	var database *db.ProductDatabase
+
+	a.Connect("postgres", func(ctx context.Context) (err error) {
+		database, err = db.NewProductDatabase(ctx, cfg.Postgres)
 
-	address := strings.Split(kafkaEnv, ",")
+		return err
+	})
+	a.Lifecycle.OnStop("database", func(context.Context) error { return database.CloseProductDB() })
+	a.Health.Add("postgres", health.Database(database.Conn))
+
+	// Миграции схемы или подкоманда migrate
+	a.Migrate(database.Migrations)
 
 	// Настройка kafka продюсера
-	p, err := k.NewProducer(address, topic)
+	p, err := k.NewProducer(cfg.Kafka.Brokers, cfg.Kafka.Topic, a.ProducerConfig())
 	if err != nil {
 		log.Fatalf("Failed to create Kafka producer: %v", err)
 	}
 
-	// Инициализация обработчика
-	productHandler := product.NewProductHandler(p)
+	a.Lifecycle.OnStop("kafka producer", func(context.Context) error {
+		p.Close()
 
-	// Настройка api
-	r := mux.NewRouter()
-	r.HandleFunc("/products", productHandler.AddProduct).Methods("POST")
-	r.HandleFunc("/products/{id}", productHandler.DeleteProduct).Methods("DELETE")
-	r.HandleFunc("/products/{id}", productHandler.UpdateProduct).Methods("PUT")
+		return nil
+	})
+	a.Health.Add("kafka", health.Kafka(p.Producer))
 
-	r.Use(monitoring.Middleware)
+	// Открытые ключи для проверки токенов загружаются из сервиса пользователей
+	auth.SetKeyProvider(auth.NewRemoteKeySet(cfg.Auth.JWKSURL, auth.JWKSCacheTTL))
 
-	// Эндпоинт для метрик
-	r.Path("/metrics").Handler(monitoring.MetricsHandler())
+	// Отозванные токены проверяются в общем redis сервиса пользователей
+	if cfg.Redis.Address != "" {
+		var cache *redis.Cache
 
-	// Настройка HTTP сервера
-	serverAddress := ":8081"
-	server := &http.Server{
-		Addr:    serverAddress,
-		Handler: r,
+		a.Connect("redis", func(ctx context.Context) (err error) {
+			cache, err = redis.NewCache(ctx, cfg.Redis.Address, cfg.Redis.Password, cfg.Redis.DB)
+
+			return err
+		})
+		a.Lifecycle.OnStop("redis", func(context.Context) error { return cache.Close() })
+		a.Health.Add("redis", health.Redis(cache))
+		auth.SetRevocationList(auth.NewRevocationList(cache))
+	} else {
+		log.Println("REDIS_ADDRESS is not set, token revocations from user service are not checked")
 	}
 
-	// Канал для системных сигналов
-	stopChan := make(chan os.Signal, 1)
-	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
+	// Инициализация обработчика
+	productHandler := product.NewProductHandler(database)
 
-	// Запуск HTTP сервера
-	go func() {
-		log.Printf("Starting server on %s", serverAddress)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Error starting server: %s", err)
-		}
-	}()
+	// Отправка событий из outbox в kafka, при остановке неотправленные
+	// сообщения останутся в outbox до следующего запуска
+	a.Lifecycle.Go("outbox relay", func(ctx context.Context) error {
+		k.NewOutboxRelay("product", database.Outbox, p).Run(ctx)
 
-	// Ожидание сигнала завершения
-	<-stopChan
-	log.Println("Shutting down gracefully...")
+		return nil
+	})
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Очистка отправленных сообщений outbox
+	a.Lifecycle.Go("outbox retention", func(ctx context.Context) error {
+		database.Outbox.RunRetention(ctx, cfg.Kafka.OutboxRetention, time.Hour)
 
-	p.Close()
+		return nil
+	})
 
-	// Завершение работы HTTP сервера
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Failed to shutdown HTTP server: %v", err)
+	// Настройка api
+	r := a.Router
+	r.HandleFunc("/products", productHandler.ListProducts).Methods("GET")
+	r.HandleFunc("/products/{id}", productHandler.GetProduct).Methods("GET")
+
+	// Изменять каталог могут только администраторы и продавцы
+	canEdit := func(h http.HandlerFunc) http.Handler {
+		return auth.JWTMiddleware(auth.RequireRole(auth.RoleAdmin, auth.RoleMerchant)(h))
 	}
+	r.Handle("/products", canEdit(productHandler.AddProduct)).Methods("POST")
+	r.Handle("/products/{id}", canEdit(productHandler.DeleteProduct)).Methods("DELETE")
+	r.Handle("/products/{id}", canEdit(productHandler.UpdateProduct)).Methods("PUT")
 
-	log.Println("Product service stopped gracefully")
+	// Ожидание сигнала завершения
+	a.Run()
 }
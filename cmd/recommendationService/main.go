@@ -3,144 +3,129 @@ package main
 import (
 	"context"
 	"log"
-	"net/http"
-	"os"
-	"os/signal"
-	"strings"
-	"syscall"
+	"time"
 
+	"Go-internship-Manifure/internal/app"
+	"Go-internship-Manifure/internal/config"
 	"Go-internship-Manifure/internal/db/recommendation_db"
 	"Go-internship-Manifure/internal/handlers/recommendation"
+	"Go-internship-Manifure/internal/health"
 	"Go-internship-Manifure/internal/kafka"
-	"Go-internship-Manifure/internal/monitoring"
 	"Go-internship-Manifure/internal/redis"
-	"github.com/gorilla/mux"
 )
 
 func main() {
-	monitoring.Init()
+	defaults := config.Default()
+	defaults.HTTP.Addr = ":8082"
+	defaults.Redis.Address = "localhost:6379"
+	// Таблицы сервиса хранятся в собственной схеме
+	defaults.Postgres.Schema = "recommendation"
+	defaults.Kafka.Topics = []string{defaults.Kafka.ProductTopic, "user-updates"}
+	defaults.Kafka.ConsumerGroup = "recommendation_service"
+	// Срок остановки включает обработку уже прочитанных сообщений
+	defaults.ShutdownTimeout = 30 * time.Second
+
+	a := app.New("recommendation", defaults)
+	cfg := a.Config
 
-	kafkaEnv := os.Getenv("KAFKA_ADDRESS")
-	if kafkaEnv == "" {
-		kafkaEnv = "localhost:9091,localhost:9092,localhost:9093" // Значение по умолчанию
-	}
-
-	host := os.Getenv("POSTGRES_HOST")
-	if host == "" {
-		host = "localhost" // Значение по умолчанию
-	}
-
-	user := os.Getenv("POSTGRES_USER")
-	if user == "" {
-		user = "postgres" // Значение по умолчанию
-	}
-
-	password := os.Getenv("POSTGRES_PASSWORD")
-	if password == "" {
-		password = "1" // Значение по умолчанию
-	}
-
-	dbname := os.Getenv("POSTGRES_DB")
-	if dbname == "" {
-		dbname = "postgres" // Значение по умолчанию
-	}
+	// Подключение к базе данных
+	var database *db.RecommendationDatabase
 
-	port := os.Getenv("POSTGRES_PORT")
-	if port == "" {
-		port = "5432" // Значение по умолчанию
-	}
+	a.Connect("postgres", func(ctx context.Context) (err error) {
+		database, err = db.NewRecommendationDatabase(ctx, cfg.Postgres)
 
-	redisAddress := os.Getenv("REDIS_ADDRESS")
-	if redisAddress == "" {
-		redisAddress = "localhost:6379" // Значение по умолчанию
-	}
+		return err
+	})
+	a.Lifecycle.OnStop("database", func(context.Context) error { return database.CloseRecommendationDB() })
+	a.Health.Add("postgres", health.Database(database.Conn))
 
-	address := strings.Split(kafkaEnv, ",")
-	consumerGroup := "recommendation_service"
-	topics := []string{"product-updates", "user-updates"}
-
-	// Подключение к базе данных
-	database := db.NewRecommendationDatabase(host, user, password, dbname, port)
+	// Миграции схемы или подкоманда migrate
+	a.Migrate(database.Migrations)
 
 	// Подключение к redis
-	cache := redis.NewCache(redisAddress, "", 0)
+	var cache *redis.Cache
+
+	a.Connect("redis", func(ctx context.Context) (err error) {
+		cache, err = redis.NewCache(ctx, cfg.Redis.Address, cfg.Redis.Password, cfg.Redis.DB)
+
+		return err
+	})
+	a.Lifecycle.OnStop("redis", func(context.Context) error { return cache.Close() })
+	// Без redis список рекомендаций читается из базы
+	a.Health.AddOptional("redis", health.Redis(cache))
+
+	// Популярность с затуханием, общая для обработчика событий и API
+	scoring := &recommendation.Scoring{
+		HalfLife: cfg.Popularity.HalfLife,
+		Weights: recommendation.Weights{
+			CartAdd:       cfg.Popularity.CartAddWeight,
+			ProductUpdate: cfg.Popularity.ProductUpdateWeight,
+		},
+	}
 
 	// Инициализация обработчиков
-	recommendationHandler := recommendation.NewRecommendationHandler(database.Conn)
+	recommendationHandler := recommendation.NewRecommendationHandler(database.Conn, cache, database.Ledger)
+	recommendationHandler.Scoring = scoring
+	recommendationHandler.ProductTopic = cfg.Kafka.ProductTopic
 
 	apiHandler := recommendation.NewRecommendationAPIHandler(database.Conn, cache)
+	apiHandler.Scoring = scoring
 
-	// Контекст для graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Перенос эпохи популярности, чтобы хранимые значения не росли неограниченно
+	a.Lifecycle.Go("popularity rebase", func(ctx context.Context) error {
+		scoring.RunRebase(ctx, database.Conn, cfg.Popularity.RebaseInterval)
 
-	// Канал для системных сигналов
-	stopChan := make(chan os.Signal, 1)
-	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
+		return nil
+	})
 
-	// Настройка kafka консьюмера
-	consumer, err := kafka.NewConsumer(recommendationHandler, address, topics, consumerGroup, 1)
-	if err != nil {
-		log.Fatalf("Failed to create consumer: %v", err)
-	}
+	// Очистка журнала обработанных событий
+	a.Lifecycle.Go("processed events retention", func(ctx context.Context) error {
+		database.Ledger.RunRetention(ctx, cfg.Kafka.ProcessedEventsRetention, time.Hour)
 
-	// Запуск kafka consumer в отдельной горутине
-	go func() {
-		log.Println("Starting Kafka consumer...")
-
-		consumer.Start(ctx)
-	}()
+		return nil
+	})
 
 	// Настройка api
-	r := mux.NewRouter()
-	r.HandleFunc("/recommendations", apiHandler.GetRecommendations).Methods("GET")
+	a.Router.HandleFunc("/recommendations", apiHandler.GetRecommendations).Methods("GET")
 
-	r.Use(monitoring.Middleware)
+	// Consumer запускается после HTTP сервера и останавливается раньше него
+	a.Serve()
 
-	// Эндпоинт для метрик
-	r.Path("/metrics").Handler(monitoring.MetricsHandler())
+	// Сообщения, которые не удалось обработать, отправляются в <topic>.dlq.
+	// Отправка ждет подтверждения каждого сообщения, поэтому без задержки накопления пачки
+	deadLetterConfig := a.ProducerConfig()
+	deadLetterConfig.Linger = 0
 
-	// Запуск HTTP сервера
-	serverAddress := ":8082"
-	server := &http.Server{
-		Addr:    serverAddress,
-		Handler: r,
+	deadLetter, err := kafka.NewProducer(cfg.Kafka.Brokers, "", deadLetterConfig)
+	if err != nil {
+		log.Fatalf("Failed to create dead letter producer: %v", err)
 	}
 
-	go func() {
-		log.Printf("Starting HTTP server on %s", serverAddress)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to listen on %s: %v", serverAddress, err)
-		}
-	}()
+	a.Lifecycle.OnStop("dead letter producer", func(context.Context) error {
+		deadLetter.Close()
 
-	// Ожидание сигнала завершения
-	<-stopChan
-	log.Println("Shutting down gracefully...")
-
-	cancel()
-
-	// Завершение работы Kafka consumer
-	if err := consumer.Close(); err != nil {
-		log.Fatalf("Error closing consumer: %v", err)
-	}
+		return nil
+	})
 
-	// Завершение работы базы данных
-	if err := database.CloseRecommendationDB(); err != nil {
-		log.Fatalf("Error closing database connection: %v", err)
+	// Настройка kafka консьюмера
+	consumer, err := kafka.NewConsumer(recommendationHandler, cfg.Kafka.Brokers, cfg.Kafka.Topics, cfg.Kafka.ConsumerGroup, cfg.Kafka.Workers)
+	if err != nil {
+		log.Fatalf("Failed to create consumer: %v", err)
 	}
 
-	// Завершение работы Redis
-	if err := cache.Close(); err != nil {
-		log.Fatalf("Error closing redis connection: %v", err)
-	}
+	consumer.DeadLetter = deadLetter
+	a.Health.Add("kafka", health.Kafka(consumer))
 
-	// Завершение работы HTTP сервера
-	log.Println("Shutting down metrics server...")
+	// Consumer останавливается первым: прекращает чтение, дожидается обработки
+	// прочитанных сообщений и фиксирует смещения перед закрытием
+	a.Lifecycle.OnStop("kafka consumer", consumer.Close)
+	a.Lifecycle.Go("kafka consumer", func(ctx context.Context) error {
+		log.Println("Starting Kafka consumer...")
+		consumer.Start(ctx)
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Error shutting down server: %v", err)
-	}
+		return nil
+	})
 
-	log.Println("Recommendation service stopped gracefully")
+	// Ожидание сигнала завершения
+	a.Run()
 }
@@ -1,87 +1,125 @@
 package main
 
 import (
-	"Go-internship-Manifure/internal/auth"
 	"context"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
-	"strings"
-	"syscall"
 	"time"
 
+	"Go-internship-Manifure/internal/app"
+	"Go-internship-Manifure/internal/auth"
+	"Go-internship-Manifure/internal/catalog"
+	"Go-internship-Manifure/internal/config"
+	"Go-internship-Manifure/internal/db/user_db"
 	"Go-internship-Manifure/internal/handlers/user"
+	"Go-internship-Manifure/internal/health"
 	k "Go-internship-Manifure/internal/kafka"
-	"Go-internship-Manifure/internal/monitoring"
-	"github.com/gorilla/mux"
+	"Go-internship-Manifure/internal/redis"
 )
 
-const topic = "user-updates"
-
 func main() {
-	monitoring.Init()
+	defaults := config.Default()
+	defaults.HTTP.Addr = ":8080"
+	defaults.Kafka.Topic = "user-updates"
+	defaults.Catalog.URL = "http://localhost:8081"
 
-	kafkaEnv := os.Getenv("KAFKA_ADDRESS")
-	if kafkaEnv == "" {
-		kafkaEnv = "localhost:9091,localhost:9092,localhost:9093" // Значение по умолчанию
-	}
+	a := app.New("user", defaults)
+	cfg := a.Config
+
+	// Подключение к базе данных
+	var database *db.UserDatabase
+
+	a.Connect("postgres", func(ctx context.Context) (err error) {
+		database, err = db.NewUserDatabase(ctx, cfg.Postgres)
 
-	address := strings.Split(kafkaEnv, ",")
+		return err
+	})
+	a.Lifecycle.OnStop("database", func(context.Context) error { return database.CloseUserDB() })
+	a.Health.Add("postgres", health.Database(database.Conn))
+
+	// Миграции схемы или подкоманда migrate
+	a.Migrate(database.Migrations)
 
 	// Настройка kafka продюсера
-	p, err := k.NewProducer(address, topic)
+	p, err := k.NewProducer(cfg.Kafka.Brokers, cfg.Kafka.Topic, a.ProducerConfig())
 	if err != nil {
 		log.Fatalf("Failed to create Kafka producer: %v", err)
 	}
 
-	// Инициализация обработчика
-	userHandler := user.NewUserHandler(p)
+	a.Lifecycle.OnStop("kafka producer", func(context.Context) error {
+		p.Close()
 
-	// Настройка api
-	r := mux.NewRouter()
-	r.HandleFunc("/users", userHandler.RegisterUser).Methods("POST")
-	r.Handle("/users/{id}", auth.JWTMiddleware(http.HandlerFunc(userHandler.GetUser))).Methods("GET")
-	r.Handle("/users/{id}", auth.JWTMiddleware(http.HandlerFunc(userHandler.UpdateUser))).Methods("PUT")
+		return nil
+	})
+	a.Health.Add("kafka", health.Kafka(p.Producer))
+
+	// Ключи подписи токенов, открытые ключи публикуются для других сервисов
+	var keys *auth.KeySet
+	if cfg.Auth.KeysDir != "" {
+		keys, err = auth.LoadKeySet(cfg.Auth.KeysDir, cfg.Auth.SigningKeyID)
+	} else {
+		log.Println("JWT_KEYS_DIR is not set, generating ephemeral signing key: tokens will not survive restart")
+		keys, err = auth.GenerateKeySet()
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	log.Printf("Signing tokens with key %s", keys.SigningKeyID())
+	auth.SetSigningKeys(keys)
 
-	// Подключаем middleware для мониторинга
-	r.Use(monitoring.Middleware)
+	// Список отозванных токенов хранится в redis, без него - в памяти процесса
+	if cfg.Redis.Address != "" {
+		var cache *redis.Cache
 
-	// Регистрируем обработчик метрик Prometheus
-	r.Path("/metrics").Handler(monitoring.MetricsHandler())
+		a.Connect("redis", func(ctx context.Context) (err error) {
+			cache, err = redis.NewCache(ctx, cfg.Redis.Address, cfg.Redis.Password, cfg.Redis.DB)
 
-	// Настройка HTTP сервера
-	serverAddress := ":8080"
-	server := &http.Server{
-		Addr:    serverAddress,
-		Handler: r,
+			return err
+		})
+		a.Lifecycle.OnStop("redis", func(context.Context) error { return cache.Close() })
+		a.Health.Add("redis", health.Redis(cache))
+		auth.SetRevocationList(auth.NewRevocationList(cache))
+	} else {
+		log.Println("REDIS_ADDRESS is not set, revoked tokens are stored in memory")
 	}
 
-	// Канал для системных сигналов
-	stopChan := make(chan os.Signal, 1)
-	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
+	// Инициализация обработчика
+	userHandler := user.NewUserHandler(database, catalog.NewClient(cfg.Catalog.URL))
 
-	// Запуск HTTP сервера
-	go func() {
-		log.Printf("Starting server on %s", serverAddress)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Error starting server: %s", err)
-		}
-	}()
+	// Отправка событий из outbox в kafka, при остановке неотправленные
+	// сообщения останутся в outbox до следующего запуска
+	a.Lifecycle.Go("outbox relay", func(ctx context.Context) error {
+		k.NewOutboxRelay("user", database.Outbox, p).Run(ctx)
 
-	// Ожидание сигнала завершения
-	<-stopChan
-	log.Println("Shutting down gracefully...")
+		return nil
+	})
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Очистка отправленных сообщений outbox
+	a.Lifecycle.Go("outbox retention", func(ctx context.Context) error {
+		database.Outbox.RunRetention(ctx, cfg.Kafka.OutboxRetention, time.Hour)
 
-	p.Close()
+		return nil
+	})
 
-	// Завершение работы HTTP сервера
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Failed to shutdown HTTP server: %v", err)
-	}
+	// Настройка api
+	r := a.Router
+	r.Handle("/.well-known/jwks.json", keys.JWKSHandler()).Methods("GET")
+	r.HandleFunc("/users", userHandler.RegisterUser).Methods("POST")
+	r.HandleFunc("/login", userHandler.Login).Methods("POST")
+	r.HandleFunc("/token/refresh", userHandler.RefreshToken).Methods("POST")
+	r.Handle("/logout", auth.JWTMiddleware(http.HandlerFunc(userHandler.Logout))).Methods("POST")
+
+	// Профиль доступен только самому пользователю и администратору
+	selfOrAdmin := auth.RequireSelfOrAdmin("id")
+	r.Handle("/users/{id}", auth.JWTMiddleware(selfOrAdmin(http.HandlerFunc(userHandler.GetUser)))).Methods("GET")
+	r.Handle("/users/{id}", auth.JWTMiddleware(selfOrAdmin(http.HandlerFunc(userHandler.UpdateUser)))).Methods("PUT")
+	r.Handle("/users/{id}/cart", auth.JWTMiddleware(selfOrAdmin(http.HandlerFunc(userHandler.GetCart)))).Methods("GET")
+	r.Handle("/users/{id}/cart", auth.JWTMiddleware(selfOrAdmin(http.HandlerFunc(userHandler.AddCartItem)))).Methods("POST")
+	r.Handle("/users/{id}/cart", auth.JWTMiddleware(selfOrAdmin(http.HandlerFunc(userHandler.ClearCart)))).Methods("DELETE")
+	r.Handle("/users/{id}/cart/{product_id}", auth.JWTMiddleware(selfOrAdmin(http.HandlerFunc(userHandler.RemoveCartItem)))).Methods("DELETE")
 
-	log.Println("User service stopped gracefully")
+	// Ожидание сигнала завершения
+	a.Run()
 }
@@ -0,0 +1,7 @@
+-- Отдельные пользователи и схемы сервисов рекомендаций и аналитики. Сервис
+-- подключается своим пользователем и создает таблицы в своей схеме.
+CREATE ROLE recommendation LOGIN PASSWORD 'recommendation';
+CREATE SCHEMA recommendation AUTHORIZATION recommendation;
+
+CREATE ROLE analytics LOGIN PASSWORD 'analytics';
+CREATE SCHEMA analytics AUTHORIZATION analytics;
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"Go-internship-Manifure/internal/config"
+	"Go-internship-Manifure/internal/health"
+	"Go-internship-Manifure/internal/kafka"
+	"Go-internship-Manifure/internal/lifecycle"
+	"Go-internship-Manifure/internal/migrate"
+	"Go-internship-Manifure/internal/monitoring"
+	"Go-internship-Manifure/internal/retry"
+	"github.com/gorilla/mux"
+)
+
+// Общий каркас сервиса: конфигурация, роутер с метриками, health эндпоинты
+// и остановка компонентов. main сервиса добавляет только свои обработчики
+// и проверки зависимостей.
+type App struct {
+	Name      string
+	Config    *config.Config
+	Router    *mux.Router
+	Health    *health.Health
+	Lifecycle *lifecycle.Lifecycle
+
+	// Аргументы командной строки после флагов, например migrate up
+	Args []string
+
+	serving bool
+}
+
+// Загружает конфигурацию поверх defaults из файла, переменных окружения
+// и аргументов командной строки. Ошибка конфигурации завершает процесс.
+func New(name string, defaults config.Config) *App {
+	// Имя сервиса видно в pg_stat_activity и в метриках пула соединений
+	if defaults.Postgres.ApplicationName == "" {
+		defaults.Postgres.ApplicationName = name + "-service"
+	}
+
+	cfg, args, err := config.Load(defaults, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load %s service configuration: %v", name, err)
+	}
+
+	log.Printf("Starting %s service with configuration:\n%s", name, cfg)
+
+	monitoring.Init()
+
+	checks := health.New(cfg.HealthCheckTimeout)
+
+	r := mux.NewRouter()
+
+	// Подключаем middleware для мониторинга
+	r.Use(monitoring.Middleware)
+
+	// Эндпоинт для метрик
+	r.Path("/metrics").Handler(monitoring.MetricsHandler())
+
+	// Liveness - процесс запущен, readiness - зависимости доступны
+	r.HandleFunc("/healthz", health.LiveHandler).Methods("GET")
+	r.HandleFunc("/readyz", checks.ReadyHandler).Methods("GET")
+
+	return &App{
+		Name:      name,
+		Config:    cfg,
+		Router:    r,
+		Health:    checks,
+		Lifecycle: lifecycle.New(cfg.ShutdownTimeout),
+		Args:      args,
+	}
+}
+
+// Настройки kafka продюсера из конфигурации.
+func (a *App) ProducerConfig() kafka.ProducerConfig {
+	p := a.Config.Kafka.Producer
+
+	return kafka.ProducerConfig{
+		Async:       p.Async,
+		Linger:      p.Linger,
+		BatchSize:   p.BatchSize,
+		Compression: p.Compression,
+		Idempotence: p.Idempotence,
+
+		DeliveryTimeout: p.DeliveryTimeout,
+	}
+}
+
+// Подключается к зависимости name, повторяя connect с экспоненциальной
+// задержкой по настройкам Connect. SIGINT/SIGTERM прерывает ожидание. Если
+// подключиться не удалось, запущенные компоненты останавливаются и процесс завершается.
+func (a *App) Connect(name string, connect func(ctx context.Context) error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	policy := retry.Policy{
+		MaxAttempts:    a.Config.Connect.Attempts,
+		InitialBackoff: a.Config.Connect.InitialBackoff,
+		MaxBackoff:     a.Config.Connect.MaxBackoff,
+	}
+
+	err := retry.Do(ctx, policy, connect, func(attempt int, err error) {
+		monitoring.DependencyUp.WithLabelValues(name).Set(0)
+		log.Printf("Failed to connect to %s (attempt %d of %d): %v", name, attempt, policy.MaxAttempts, err)
+	})
+	if err != nil {
+		a.exit(fmt.Errorf("giving up connecting to %s: %w", name, err))
+	}
+
+	monitoring.DependencyUp.WithLabelValues(name).Set(1)
+}
+
+// Выполняет подкоманду migrate (up, down, status, to <version>) и завершает
+// процесс. Без подкоманды применяет непримененные миграции, если это не
+// отключено в конфигурации.
+func (a *App) Migrate(migrations *migrate.Migrator) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(a.Args) > 0 {
+		if a.Args[0] != "migrate" {
+			a.exit(fmt.Errorf("unknown command %q, expected migrate", a.Args[0]))
+		}
+
+		err := migrations.Run(ctx, a.Args[1:], os.Stdout)
+		if err != nil {
+			err = fmt.Errorf("migrate: %w", err)
+		}
+
+		a.exit(err)
+	}
+
+	if !a.Config.Postgres.MigrateOnStart {
+		log.Println("Schema migrations on start are disabled")
+
+		return
+	}
+
+	if err := migrations.Up(ctx); err != nil {
+		a.exit(fmt.Errorf("failed to migrate database: %w", err))
+	}
+}
+
+// Останавливает запущенные компоненты и завершает процесс, с кодом 1 при ошибке.
+func (a *App) exit(err error) {
+	if err != nil {
+		log.Printf("%s service: %v", a.Name, err)
+	}
+
+	if stopErr := a.Lifecycle.Shutdown(); stopErr != nil {
+		log.Printf("Failed to stop %s service: %v", a.Name, stopErr)
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// Запускает HTTP сервер. Компоненты, зарегистрированные после вызова,
+// останавливаются раньше сервера.
+func (a *App) Serve() {
+	if a.serving {
+		return
+	}
+
+	a.serving = true
+
+	a.Lifecycle.Serve("HTTP server", &http.Server{
+		Addr:    a.Config.HTTP.Addr,
+		Handler: a.Router,
+	})
+}
+
+// Запускает HTTP сервер, если он еще не запущен, ждет сигнала завершения
+// и останавливает компоненты.
+func (a *App) Run() {
+	a.Serve()
+
+	if err := a.Lifecycle.Run(); err != nil {
+		log.Fatalf("%s service stopped with error: %v", a.Name, err)
+	}
+
+	log.Printf("%s service stopped gracefully", a.Name)
+}
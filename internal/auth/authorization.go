@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	RoleUser     = "user"
+	RoleMerchant = "merchant"
+	RoleAdmin    = "admin"
+)
+
+type contextKey int
+
+const claimsContextKey contextKey = iota
+
+func validRole(role string) bool {
+	switch role {
+	case RoleUser, RoleMerchant, RoleAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// Сохраняет данные проверенного токена в контексте.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// Возвращает данные токена, сохраненные JWTMiddleware в контексте запроса.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*Claims)
+
+	return claims, ok
+}
+
+// Возвращает id аутентифицированного пользователя из контекста запроса.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	return claims.UserID, true
+}
+
+// Проверяет, что у пользователя есть роль администратора.
+func (c *Claims) IsAdmin() bool {
+	return c.Role == RoleAdmin
+}
+
+// Пропускает запрос, только если переменная пути param совпадает с id пользователя
+// из токена или пользователь является администратором. Используется после JWTMiddleware.
+func RequireSelfOrAdmin(param string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !claims.IsAdmin() && mux.Vars(r)[param] != claims.UserID {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Пропускает запрос, только если роль пользователя из токена входит в roles.
+// Используется после JWTMiddleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !slices.Contains(roles, claims.Role) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Go-internship-Manifure/internal/auth"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireSelfOrAdmin(t *testing.T) {
+	auth.SetRevocationList(auth.NewRevocationList(nil))
+
+	router := mux.NewRouter()
+	router.Handle("/users/{id}", auth.JWTMiddleware(auth.RequireSelfOrAdmin("id")(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }),
+	)))
+
+	tests := []struct {
+		name   string
+		userID string
+		role   string
+		target string
+		want   int
+	}{
+		{name: "own profile", userID: "alice", role: auth.RoleUser, target: "alice", want: http.StatusOK},
+		{name: "foreign profile", userID: "alice", role: auth.RoleUser, target: "bob", want: http.StatusForbidden},
+		{name: "admin", userID: "root", role: auth.RoleAdmin, target: "bob", want: http.StatusOK},
+		{name: "unknown role", userID: "alice", role: "superuser", target: "alice", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, err := auth.GenerateTokenPair(tt.userID, tt.role)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.target, nil)
+			req.Header.Set("Authorization", pair.AccessToken)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	auth.SetRevocationList(auth.NewRevocationList(nil))
+
+	handler := auth.JWTMiddleware(auth.RequireRole(auth.RoleAdmin, auth.RoleMerchant)(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }),
+	))
+
+	for role, want := range map[string]int{
+		auth.RoleAdmin:    http.StatusOK,
+		auth.RoleMerchant: http.StatusOK,
+		auth.RoleUser:     http.StatusForbidden,
+	} {
+		t.Run(role, func(t *testing.T) {
+			pair, err := auth.GenerateTokenPair("user-1", role)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/products", nil)
+			req.Header.Set("Authorization", pair.AccessToken)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, want, rec.Code)
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
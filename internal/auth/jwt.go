@@ -1,63 +1,203 @@
 package auth
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"net/http"
-	"os"
+	"strings"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute   // Короткоживущий токен доступа
+	RefreshTokenTTL = 7 * 24 * time.Hour // Токен обновления, меняется при каждом использовании
+
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+var (
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrTokenRevoked    = errors.New("token revoked")
+	ErrKeysUnavailable = errors.New("verification keys unavailable") // Токен нельзя проверить, пока ключи не загружены
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET")) // Секретный ключ получаемый из переменной окружения
+var (
+	signingKeys      *KeySet     // Ключи подписи, задаются только в сервисе пользователей
+	verificationKeys KeyProvider // Открытые ключи для проверки токенов
+
+	revocations = NewRevocationList(nil) // Список отозванных токенов, по умолчанию в памяти
+)
+
+// Данные, которые содержатся в токене.
+type Claims struct {
+	UserID    string `json:"user_id"`
+	Role      string `json:"role"`
+	TokenType string `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// Пара токенов, которая выдается при регистрации, входе и обновлении.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// Устанавливает ключи, которыми подписываются и проверяются токены.
+func SetSigningKeys(keys *KeySet) {
+	signingKeys = keys
+	verificationKeys = keys
+}
+
+// Устанавливает источник открытых ключей для сервисов, которые только проверяют токены.
+func SetKeyProvider(provider KeyProvider) {
+	verificationKeys = provider
+}
+
+// Устанавливает список отозванных токенов, используемый при проверке.
+func SetRevocationList(list RevocationList) {
+	revocations = list
+}
+
+// Генерация пары токенов доступа и обновления для пользователя с указанной ролью.
+func GenerateTokenPair(userID, role string) (TokenPair, error) {
+	accessToken, err := generateToken(userID, role, TokenTypeAccess, AccessTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, err := generateToken(userID, role, TokenTypeRefresh, RefreshTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func generateToken(userID, role, tokenType string, ttl time.Duration) (string, error) {
+	if signingKeys == nil {
+		return "", ErrNoSigningKey
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:    userID,
+		Role:      role,
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return signingKeys.sign(claims)
+}
+
+// Проверяет подпись, срок действия, тип токена и отсутствие в списке отозванных.
+func ParseToken(tokenString, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+
+	if verificationKeys == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	// Принимаются только асимметричные алгоритмы, ключ выбирается по kid из заголовка
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no kid header")
+		}
+
+		key, err := verificationKeys.PublicKey(kid)
+		if err != nil && !errors.Is(err, ErrUnknownKey) {
+			return nil, fmt.Errorf("%w: %w", ErrKeysUnavailable, err)
+		}
+
+		return key, err
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		// Недоступность ключей не означает, что токен недействителен
+		if errors.Is(err, ErrKeysUnavailable) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if claims.TokenType != tokenType || claims.UserID == "" || claims.ID == "" || !validRole(claims.Role) {
+		return nil, ErrInvalidToken
+	}
+
+	revoked, err := revocations.IsRevoked(claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// Проверяет и отзывает токен обновления, новая пара выдается вызывающим
+// с актуальной ролью пользователя.
+func ConsumeRefreshToken(refreshToken string) (*Claims, error) {
+	claims, err := ParseToken(refreshToken, TokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	// Отзыв атомарен, поэтому один токен обновления нельзя использовать дважды
+	revoked, err := revocations.Revoke(claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
 
-// Генерация JWT токена для пользователя.
-func GenerateJWT(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(), // Срок действия 24 часа
+	if !revoked {
+		return nil, ErrTokenRevoked
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return claims, nil
+}
+
+// Отзывает токен до истечения его срока действия.
+func RevokeToken(claims *Claims) error {
+	if _, err := revocations.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
 
-	return token.SignedString(jwtKey)
+	return nil
 }
 
 func JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 		if tokenString == "" {
 			http.Error(w, "Authorization header missing", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		claims, err := ParseToken(tokenString, TokenTypeAccess)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrKeysUnavailable):
+				http.Error(w, "Failed to verify token", http.StatusServiceUnavailable)
+			case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenRevoked):
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+			default:
+				// Список отозванных токенов недоступен
+				http.Error(w, "Failed to verify token", http.StatusServiceUnavailable)
 			}
-			return jwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		// Пример извлечения данных из токена
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Failed to parse token claims", http.StatusUnauthorized)
-			return
-		}
 
-		userID, ok := claims["user_id"].(string)
-		if !ok {
-			http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
 			return
 		}
 
-		// Передача userID в контекст
-		ctx := context.WithValue(r.Context(), "user_id", userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		// Передача данных токена в контекст
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
 	})
 }
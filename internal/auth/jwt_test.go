@@ -0,0 +1,94 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/auth"
+	"Go-internship-Manifure/internal/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumeRefreshToken(t *testing.T) {
+	auth.SetRevocationList(auth.NewRevocationList(redis.NewCacheMock()))
+
+	pair, err := auth.GenerateTokenPair("user-1", auth.RoleUser)
+	require.NoError(t, err)
+
+	claims, err := auth.ConsumeRefreshToken(pair.RefreshToken)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", claims.UserID)
+	require.Equal(t, auth.RoleUser, claims.Role)
+
+	// Повторное использование токена обновления запрещено
+	_, err = auth.ConsumeRefreshToken(pair.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrTokenRevoked)
+
+	// Токен доступа нельзя использовать как токен обновления
+	_, err = auth.ConsumeRefreshToken(pair.AccessToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestJWTMiddlewareRejectsRevokedToken(t *testing.T) {
+	auth.SetRevocationList(auth.NewRevocationList(nil))
+
+	pair, err := auth.GenerateTokenPair("user-1", auth.RoleUser)
+	require.NoError(t, err)
+
+	handler := auth.JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		require.True(t, ok)
+		require.Equal(t, "user-1", userID)
+	}))
+
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve(pair.AccessToken))
+	require.Equal(t, http.StatusUnauthorized, serve(pair.RefreshToken))
+
+	claims, err := auth.ParseToken(pair.AccessToken, auth.TokenTypeAccess)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(auth.AccessTokenTTL), claims.ExpiresAt.Time, time.Minute)
+
+	require.NoError(t, auth.RevokeToken(claims))
+	require.Equal(t, http.StatusUnauthorized, serve(pair.AccessToken))
+}
+
+func TestJWTMiddlewareKeysUnavailable(t *testing.T) {
+	keys, err := auth.GenerateKeySet()
+	require.NoError(t, err)
+
+	auth.SetSigningKeys(keys)
+	auth.SetRevocationList(auth.NewRevocationList(nil))
+
+	pair, err := auth.GenerateTokenPair("user-1", auth.RoleUser)
+	require.NoError(t, err)
+
+	// Сервис пользователей, публикующий ключи, недоступен
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	auth.SetKeyProvider(auth.NewRemoteKeySet(server.URL, time.Minute))
+	t.Cleanup(func() { auth.SetKeyProvider(keys) })
+
+	_, err = auth.ParseToken(pair.AccessToken, auth.TokenTypeAccess)
+	require.ErrorIs(t, err, auth.ErrKeysUnavailable)
+	require.NotErrorIs(t, err, auth.ErrInvalidToken)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+
+	rec := httptest.NewRecorder()
+	auth.JWTMiddleware(http.NotFoundHandler()).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const minRSAKeyBits = 2048
+
+var (
+	ErrNoSigningKey = errors.New("signing key is not configured")
+	ErrUnknownKey   = errors.New("unknown key id")
+)
+
+// Источник открытых ключей для проверки подписи по kid.
+type KeyProvider interface {
+	PublicKey(kid string) (crypto.PublicKey, error)
+}
+
+// Набор ключей сервиса, выпускающего токены: один активный ключ подписи
+// и все ключи, токены которых еще принимаются.
+type KeySet struct {
+	signingKID string
+	signer     crypto.Signer
+	publicKeys map[string]crypto.PublicKey
+}
+
+// Загружает ключи из каталога: каждый файл <kid>.pem содержит закрытый ключ
+// RSA или Ed25519 (PKCS#8, PKCS#1) либо только открытый ключ (PKIX) выведенного
+// из подписи ключа. Если signingKID пустой, подписывает последний по имени закрытый ключ.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key files: %w", err)
+	}
+
+	slices.Sort(files)
+
+	ks := &KeySet{publicKeys: make(map[string]crypto.PublicKey)}
+	signers := make(map[string]crypto.Signer)
+
+	var lastSigner string
+
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", kid, err)
+		}
+
+		signer, public, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", kid, err)
+		}
+
+		ks.publicKeys[kid] = public
+
+		if signer != nil {
+			signers[kid] = signer
+			lastSigner = kid
+		}
+	}
+
+	if signingKID == "" {
+		signingKID = lastSigner
+	}
+
+	signer, ok := signers[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("%w: no private key %q in %s", ErrNoSigningKey, signingKID, dir)
+	}
+
+	ks.signingKID = signingKID
+	ks.signer = signer
+
+	return ks, nil
+}
+
+// Создает набор из одного случайного ключа Ed25519, который живет только в памяти процесса.
+func GenerateKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	kid := "ephemeral-" + uuid.New().String()[:8]
+
+	return &KeySet{
+		signingKID: kid,
+		signer:     private,
+		publicKeys: map[string]crypto.PublicKey{kid: public},
+	}, nil
+}
+
+func parseKey(data []byte) (crypto.Signer, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM block found")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, nil, fmt.Errorf("rsa key is shorter than %d bits", minRSAKeyBits)
+		}
+
+		return k, k.Public(), nil
+	case ed25519.PrivateKey:
+		return k, k.Public(), nil
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return nil, k, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// Идентификатор активного ключа подписи.
+func (ks *KeySet) SigningKeyID() string {
+	return ks.signingKID
+}
+
+// Открытый ключ по kid.
+func (ks *KeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	key, ok := ks.publicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+
+	return key, nil
+}
+
+// Подписывает токен активным ключом и проставляет kid в заголовок.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	method, err := signingMethod(ks.signer.Public())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = ks.signingKID
+
+	return token.SignedString(ks.signer)
+}
+
+// Алгоритм подписи, соответствующий типу ключа.
+func signingMethod(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// Публикуемый набор открытых ключей.
+func (ks *KeySet) JWKS() (JWKS, error) {
+	kids := make([]string, 0, len(ks.publicKeys))
+	for kid := range ks.publicKeys {
+		kids = append(kids, kid)
+	}
+
+	slices.Sort(kids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(kids))}
+
+	for _, kid := range kids {
+		jwk, err := newJWK(kid, ks.publicKeys[kid])
+		if err != nil {
+			return JWKS{}, err
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+// Обработчик /.well-known/jwks.json.
+func (ks *KeySet) JWKSHandler() http.Handler {
+	var (
+		once sync.Once
+		body []byte
+		err  error
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		once.Do(func() {
+			var set JWKS
+			if set, err = ks.JWKS(); err == nil {
+				body, err = json.Marshal(set)
+			}
+		})
+
+		if err != nil {
+			http.Error(w, "Failed to encode key set", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+
+		if _, err := w.Write(body); err != nil {
+			return
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	keys, err := auth.GenerateKeySet()
+	if err != nil {
+		panic(err)
+	}
+
+	auth.SetSigningKeys(keys)
+
+	os.Exit(m.Run())
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+// Создает каталог с выведенным из подписи ключом RSA и двумя закрытыми ключами.
+func writeKeyDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, "2024-01.pem"), "PRIVATE KEY", der)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err = x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, "2024-02.pem"), "PRIVATE KEY", der)
+
+	retired, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	der, err = x509.MarshalPKIXPublicKey(&retired.PublicKey)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, "2023-12.pem"), "PUBLIC KEY", der)
+
+	return dir
+}
+
+func TestLoadKeySetRotation(t *testing.T) {
+	dir := writeKeyDir(t)
+
+	// По умолчанию подписывает последний по имени закрытый ключ
+	keys, err := auth.LoadKeySet(dir, "")
+	require.NoError(t, err)
+	require.Equal(t, "2024-02", keys.SigningKeyID())
+
+	_, err = auth.LoadKeySet(dir, "2023-12")
+	require.ErrorIs(t, err, auth.ErrNoSigningKey)
+
+	// Токен, подписанный старым ключом RSA, проверяется после смены активного ключа
+	previous, err := auth.LoadKeySet(dir, "2024-01")
+	require.NoError(t, err)
+
+	auth.SetSigningKeys(previous)
+
+	pair, err := auth.GenerateTokenPair("user-1", auth.RoleUser)
+	require.NoError(t, err)
+
+	auth.SetSigningKeys(keys)
+	t.Cleanup(func() {
+		ephemeral, err := auth.GenerateKeySet()
+		require.NoError(t, err)
+		auth.SetSigningKeys(ephemeral)
+	})
+
+	claims, err := auth.ParseToken(pair.AccessToken, auth.TokenTypeAccess)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", claims.UserID)
+
+	set, err := keys.JWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 3)
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	keys, err := auth.LoadKeySet(writeKeyDir(t), "")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(keys.JWKSHandler())
+	defer server.Close()
+
+	remote := auth.NewRemoteKeySet(server.URL, time.Minute)
+
+	for _, kid := range []string{"2023-12", "2024-01", "2024-02"} {
+		remoteKey, err := remote.PublicKey(kid)
+		require.NoError(t, err)
+
+		localKey, err := keys.PublicKey(kid)
+		require.NoError(t, err)
+
+		require.Equal(t, localKey, remoteKey)
+	}
+
+	_, err = remote.PublicKey("missing")
+	require.ErrorIs(t, err, auth.ErrUnknownKey)
+}
+
+func TestRemoteKeySetFetchesOnce(t *testing.T) {
+	keys, err := auth.LoadKeySet(writeKeyDir(t), "")
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		keys.JWKSHandler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	remote := auth.NewRemoteKeySet(server.URL, time.Minute)
+
+	// Одновременные запросы ключей дожидаются одной загрузки
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 10)
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := remote.PublicKey("2024-02")
+			errs <- err
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	require.EqualValues(t, 1, fetches.Load())
+}
+
+func TestParseTokenRejectsUnsignedAlgorithms(t *testing.T) {
+	// Токен с alg=none и подделанной ролью
+	token := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIiwia2lkIjoiMjAyNC0wMiJ9." +
+		"eyJ1c2VyX2lkIjoidXNlci0xIiwicm9sZSI6ImFkbWluIiwidG9rZW5fdHlwZSI6ImFjY2VzcyIsImp0aSI6IjEiLCJleHAiOjQxMDI0NDQ4MDB9."
+
+	_, err := auth.ParseToken(token, auth.TokenTypeAccess)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
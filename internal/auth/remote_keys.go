@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Срок кэширования загруженных ключей в сервисах, проверяющих токены.
+const JWKSCacheTTL = 10 * time.Minute
+
+const (
+	jwksFetchTimeout = 5 * time.Second
+	// Минимальный интервал между запросами ключей при встрече неизвестного kid.
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+// Набор открытых ключей, загружаемый с /.well-known/jwks.json сервиса пользователей
+// и кэшируемый на ttl. Неизвестный kid вызывает внеочередное обновление.
+// Ключи загружаются без блокировки кэша, одновременные обновления объединяются
+// в один запрос, поэтому медленный ответ не задерживает запросы с кэшированными ключами.
+type RemoteKeySet struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	fetch  singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// Создает набор ключей, загружаемых по url при первом обращении.
+func NewRemoteKeySet(url string, ttl time.Duration) *RemoteKeySet {
+	return &RemoteKeySet{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+	}
+}
+
+// Открытый ключ по kid, при необходимости обновляет кэш.
+func (rk *RemoteKeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	rk.mu.Lock()
+	key, ok := rk.keys[kid]
+	loaded := rk.keys != nil
+	age := time.Since(rk.fetchedAt)
+	rk.mu.Unlock()
+
+	if ok && age < rk.ttl {
+		return key, nil
+	}
+
+	// Неизвестный kid не должен приводить к запросу ключей на каждый токен
+	if loaded && age < jwksMinRefreshInterval {
+		if ok {
+			return key, nil
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+
+	_, err, _ := rk.fetch.Do("jwks", func() (any, error) { return nil, rk.refresh() })
+	if err != nil {
+		// Пока сервис пользователей недоступен, используются ранее загруженные ключи
+		if ok {
+			log.Printf("Failed to refresh JWKS, using cached keys: %v", err)
+
+			return key, nil
+		}
+
+		return nil, err
+	}
+
+	rk.mu.Lock()
+	key, ok = rk.keys[kid]
+	rk.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+
+	return key, nil
+}
+
+func (rk *RemoteKeySet) refresh() error {
+	resp, err := rk.client.Get(rk.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %s", resp.Status)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("Skipping JWK %s: %v", jwk.Kid, err)
+
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	rk.mu.Lock()
+	rk.keys = keys
+	rk.fetchedAt = time.Now()
+	rk.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"Go-internship-Manifure/internal/redis"
+)
+
+const revokedKeyPrefix = "revoked_token:"
+
+// Список отозванных токенов по их идентификатору (jti).
+type RevocationList interface {
+	// Revoke отзывает токен до момента until, возвращает false, если токен уже был отозван.
+	Revoke(jti string, until time.Time) (bool, error)
+	IsRevoked(jti string) (bool, error)
+}
+
+// Список отозванных токенов в кэше, записи живут до истечения срока токена.
+type cacheRevocationList struct {
+	cache redis.CacheInterface
+}
+
+// Создает список отозванных токенов поверх кэша, без кэша используется память процесса.
+func NewRevocationList(cache redis.CacheInterface) RevocationList {
+	if cache == nil {
+		return newMemoryRevocationList()
+	}
+
+	return &cacheRevocationList{cache: cache}
+}
+
+func (l *cacheRevocationList) Revoke(jti string, until time.Time) (bool, error) {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return true, nil
+	}
+
+	return l.cache.SetNX(revokedKeyPrefix+jti, "1", ttl)
+}
+
+func (l *cacheRevocationList) IsRevoked(jti string) (bool, error) {
+	value, err := l.cache.Get(revokedKeyPrefix + jti)
+	if err != nil {
+		return false, err
+	}
+
+	return value != "", nil
+}
+
+// Список отозванных токенов в памяти процесса.
+type memoryRevocationList struct {
+	revoked map[string]time.Time
+	mu      sync.Mutex
+}
+
+func newMemoryRevocationList() *memoryRevocationList {
+	return &memoryRevocationList{revoked: make(map[string]time.Time)}
+}
+
+func (l *memoryRevocationList) Revoke(jti string, until time.Time) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	// Удаление записей о токенах, срок которых уже истек
+	for id, expiration := range l.revoked {
+		if now.After(expiration) {
+			delete(l.revoked, id)
+		}
+	}
+
+	if _, exists := l.revoked[jti]; exists {
+		return false, nil
+	}
+
+	l.revoked[jti] = until
+
+	return true, nil
+}
+
+func (l *memoryRevocationList) IsRevoked(jti string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expiration, exists := l.revoked[jti]
+
+	return exists && time.Now().Before(expiration), nil
+}
@@ -0,0 +1,48 @@
+package catalog
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 3 * time.Second
+
+// Каталог продуктов, используемый для проверки товаров в корзине.
+type ProductCatalog interface {
+	ProductExists(id string) (bool, error)
+}
+
+// Клиент API сервиса продуктов.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// Создает клиент сервиса продуктов, baseURL вида http://product-service:8081.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Проверяет существование продукта через GET /products/{id}.
+func (c *Client) ProductExists(id string) (bool, error) {
+	resp, err := c.client.Get(c.baseURL + "/products/" + url.PathEscape(id))
+	if err != nil {
+		return false, fmt.Errorf("failed to request product service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected product service status: %s", resp.Status)
+	}
+}
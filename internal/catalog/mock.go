@@ -0,0 +1,14 @@
+package catalog
+
+type MockCatalog struct {
+	Products map[string]bool
+	Err      error
+}
+
+func (m *MockCatalog) ProductExists(id string) (bool, error) {
+	if m.Err != nil {
+		return false, m.Err
+	}
+
+	return m.Products[id], nil
+}
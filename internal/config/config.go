@@ -0,0 +1,381 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// Значение, которым заменяются секреты при выводе конфигурации.
+const redacted = "******"
+
+// Настройки сервиса. Значения применяются по возрастанию приоритета: значения
+// по умолчанию, YAML файл, переменные окружения (тег env), флаги (тег flag).
+// Поля с тегом secret не выводятся в логи.
+type Config struct {
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" validate:"gt=0"`
+
+	// Таймаут каждой проверки зависимостей в /readyz
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT" validate:"gt=0"`
+
+	Connect  Connect  `yaml:"connect"`
+	HTTP     HTTP     `yaml:"http"`
+	Postgres Postgres `yaml:"postgres"`
+	Redis    Redis    `yaml:"redis"`
+	Kafka    Kafka    `yaml:"kafka"`
+	Auth     Auth     `yaml:"auth"`
+	Catalog  Catalog  `yaml:"catalog"`
+
+	Popularity Popularity `yaml:"popularity"`
+}
+
+// Повторы подключения к Postgres и Redis при запуске.
+type Connect struct {
+	Attempts       int           `yaml:"attempts" env:"CONNECT_ATTEMPTS" validate:"min=1"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" env:"CONNECT_INITIAL_BACKOFF" validate:"gt=0"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env:"CONNECT_MAX_BACKOFF" validate:"gtefield=InitialBackoff"`
+}
+
+type HTTP struct {
+	Addr string `yaml:"addr" env:"HTTP_ADDR" flag:"http-addr" validate:"required"`
+}
+
+type Postgres struct {
+	Host     string `yaml:"host" env:"POSTGRES_HOST" flag:"postgres-host" validate:"required"`
+	Port     string `yaml:"port" env:"POSTGRES_PORT" flag:"postgres-port" validate:"required,numeric"`
+	User     string `yaml:"user" env:"POSTGRES_USER" flag:"postgres-user" validate:"required"`
+	Password string `yaml:"password" env:"POSTGRES_PASSWORD" secret:"true"`
+	DB       string `yaml:"db" env:"POSTGRES_DB" flag:"postgres-db" validate:"required"`
+
+	// Схема сервиса, задает search_path. Пустое значение - схема public
+	Schema string `yaml:"schema" env:"POSTGRES_SCHEMA" flag:"postgres-schema" validate:"omitempty,max=63"`
+
+	SSLMode         string        `yaml:"sslmode" env:"POSTGRES_SSLMODE" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+	SSLRootCert     string        `yaml:"sslrootcert" env:"POSTGRES_SSLROOTCERT"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" env:"POSTGRES_CONNECT_TIMEOUT" validate:"min=0"`
+	ApplicationName string        `yaml:"application_name" env:"POSTGRES_APPLICATION_NAME"`
+
+	// Пул соединений
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"POSTGRES_MAX_OPEN_CONNS" validate:"min=0"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"POSTGRES_MAX_IDLE_CONNS" validate:"min=0"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"POSTGRES_CONN_MAX_LIFETIME" validate:"min=0"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"POSTGRES_CONN_MAX_IDLE_TIME" validate:"min=0"`
+
+	// Применять миграции схемы при запуске сервиса
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"POSTGRES_MIGRATE_ON_START"`
+}
+
+// Пустой адрес означает, что redis не используется.
+type Redis struct {
+	Address  string `yaml:"address" env:"REDIS_ADDRESS" flag:"redis-address" validate:"omitempty,hostname_port"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `yaml:"db" env:"REDIS_DB" validate:"min=0"`
+}
+
+type Kafka struct {
+	Brokers []string `yaml:"brokers" env:"KAFKA_ADDRESS" flag:"kafka-brokers" validate:"min=1,dive,hostname_port"`
+
+	// Топик, в который сервис публикует события
+	Topic string `yaml:"topic" env:"KAFKA_TOPIC"`
+
+	// Топики, которые читает consumer, и его группа
+	Topics        []string `yaml:"topics" env:"KAFKA_TOPICS" validate:"dive,required"`
+	ConsumerGroup string   `yaml:"consumer_group" env:"KAFKA_CONSUMER_GROUP" validate:"required_with=Topics"`
+	Workers       int      `yaml:"workers" env:"KAFKA_CONSUMER_WORKERS" flag:"kafka-workers" validate:"min=1"`
+
+	// Топик событий продуктов, из него consumer принимает tombstone
+	ProductTopic string `yaml:"product_topic" env:"KAFKA_PRODUCT_TOPIC" validate:"required"`
+
+	// Срок хранения журнала обработанных событий, должен быть больше срока хранения сообщений в kafka
+	ProcessedEventsRetention time.Duration `yaml:"processed_events_retention" env:"PROCESSED_EVENTS_RETENTION" validate:"gt=0"`
+
+	// Срок хранения отправленных сообщений outbox
+	OutboxRetention time.Duration `yaml:"outbox_retention" env:"OUTBOX_RETENTION" validate:"gt=0"`
+
+	Producer Producer `yaml:"producer"`
+}
+
+// Настройки продюсера, соответствуют kafka.ProducerConfig.
+type Producer struct {
+	Async       bool          `yaml:"async" env:"KAFKA_PRODUCER_ASYNC"`
+	Linger      time.Duration `yaml:"linger" env:"KAFKA_PRODUCER_LINGER" validate:"min=0"`
+	BatchSize   int           `yaml:"batch_size" env:"KAFKA_PRODUCER_BATCH_SIZE" validate:"gt=0"`
+	Compression string        `yaml:"compression" env:"KAFKA_PRODUCER_COMPRESSION" validate:"oneof=none gzip snappy lz4 zstd"`
+	Idempotence bool          `yaml:"idempotence" env:"KAFKA_PRODUCER_IDEMPOTENCE"`
+
+	DeliveryTimeout time.Duration `yaml:"delivery_timeout" env:"KAFKA_PRODUCER_DELIVERY_TIMEOUT" validate:"gtefield=Linger"`
+}
+
+type Auth struct {
+	KeysDir      string `yaml:"keys_dir" env:"JWT_KEYS_DIR"`
+	SigningKeyID string `yaml:"signing_key_id" env:"JWT_SIGNING_KEY_ID"`
+	JWKSURL      string `yaml:"jwks_url" env:"JWKS_URL" validate:"omitempty,url"`
+}
+
+type Catalog struct {
+	URL string `yaml:"url" env:"PRODUCT_SERVICE_URL" validate:"omitempty,url"`
+}
+
+// Популярность продуктов в рекомендациях: вклад события уменьшается вдвое
+// за HalfLife, раз в RebaseInterval хранимые значения пересчитываются.
+type Popularity struct {
+	HalfLife       time.Duration `yaml:"half_life" env:"POPULARITY_HALF_LIFE" validate:"gt=0"`
+	RebaseInterval time.Duration `yaml:"rebase_interval" env:"POPULARITY_REBASE_INTERVAL" validate:"gt=0"`
+
+	// Веса событий
+	CartAddWeight       float64 `yaml:"cart_add_weight" env:"POPULARITY_CART_ADD_WEIGHT" validate:"min=0"`
+	ProductUpdateWeight float64 `yaml:"product_update_weight" env:"POPULARITY_PRODUCT_UPDATE_WEIGHT" validate:"min=0"`
+}
+
+// Значения по умолчанию для локального запуска.
+func Default() Config {
+	return Config{
+		ShutdownTimeout:    10 * time.Second,
+		HealthCheckTimeout: 2 * time.Second,
+		Connect: Connect{
+			Attempts:       10,
+			InitialBackoff: 500 * time.Millisecond,
+			MaxBackoff:     10 * time.Second,
+		},
+		Postgres: Postgres{
+			Host:     "localhost",
+			Port:     "5432",
+			User:     "postgres",
+			Password: "1",
+			DB:       "postgres",
+
+			SSLMode:         "disable",
+			ConnectTimeout:  5 * time.Second,
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+
+			MigrateOnStart: true,
+		},
+		Kafka: Kafka{
+			Brokers:                  []string{"localhost:9091", "localhost:9092", "localhost:9093"},
+			ProductTopic:             "product-updates",
+			Workers:                  4,
+			ProcessedEventsRetention: 7 * 24 * time.Hour,
+			OutboxRetention:          24 * time.Hour,
+			Producer: Producer{
+				Async:       true,
+				Linger:      5 * time.Millisecond,
+				BatchSize:   1 << 20,
+				Compression: "lz4",
+				Idempotence: true,
+
+				DeliveryTimeout: 30 * time.Second,
+			},
+		},
+		Popularity: Popularity{
+			HalfLife:            7 * 24 * time.Hour,
+			RebaseInterval:      24 * time.Hour,
+			CartAddWeight:       3,
+			ProductUpdateWeight: 1,
+		},
+	}
+}
+
+// Загружает конфигурацию поверх defaults. Путь к YAML файлу задается флагом
+// -config или переменной CONFIG_FILE, args - аргументы командной строки без имени программы.
+// Возвращает также аргументы, оставшиеся после флагов (подкоманду сервиса).
+func Load(defaults Config, args []string) (*Config, []string, error) {
+	cfg := defaults
+	fields := collectFields(reflect.ValueOf(&cfg).Elem())
+
+	fs := flag.NewFlagSet("service", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "path to YAML config file")
+
+	// Флаги применяются последними, поэтому при разборе только запоминаются
+	flags := make(map[string]string)
+
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+
+		name := f.flag
+		fs.Func(name, "overrides "+f.env, func(value string) error {
+			flags[name] = value
+
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if *path != "" {
+		if err := loadFile(&cfg, *path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Пустая переменная окружения не переопределяет значение
+	for _, f := range fields {
+		if value := os.Getenv(f.env); f.env != "" && value != "" {
+			if err := setValue(f.value, value); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := flags[f.flag]; ok {
+			if err := setValue(f.value, value); err != nil {
+				return nil, nil, fmt.Errorf("invalid -%s: %w", f.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return &cfg, fs.Args(), nil
+}
+
+// Читает YAML файл, неизвестные ключи считаются ошибкой.
+func loadFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Проверяет значения конфигурации.
+func (c *Config) Validate() error {
+	if err := validator.New().Struct(c); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	return nil
+}
+
+// Конфигурация в формате YAML со скрытыми секретами.
+func (c Config) String() string {
+	for _, f := range collectFields(reflect.ValueOf(&c).Elem()) {
+		if f.secret && !f.value.IsZero() {
+			f.value.SetString(redacted)
+		}
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("<failed to marshal config: %v>", err)
+	}
+
+	return string(data)
+}
+
+// Поле конфигурации с источниками значения.
+type field struct {
+	value  reflect.Value
+	env    string
+	flag   string
+	secret bool
+}
+
+// Собирает поля вложенных структур с тегами env, flag и secret.
+func collectFields(v reflect.Value) []field {
+	var fields []field
+
+	for i := 0; i < v.NumField(); i++ {
+		value := v.Field(i)
+		tag := v.Type().Field(i).Tag
+
+		if value.Kind() == reflect.Struct {
+			fields = append(fields, collectFields(value)...)
+
+			continue
+		}
+
+		fields = append(fields, field{
+			value:  value,
+			env:    tag.Get("env"),
+			flag:   tag.Get("flag"),
+			secret: tag.Get("secret") == "true",
+		})
+	}
+
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Разбирает строковое значение в поле. Списки задаются через запятую.
+func setValue(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config field type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func testDefaults() config.Config {
+	defaults := config.Default()
+	defaults.HTTP.Addr = ":8082"
+
+	return defaults
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+http:
+  addr: ":9000"
+postgres:
+  host: db-from-file
+  user: file-user
+kafka:
+  workers: 2
+  producer:
+    linger: 50ms
+`), 0o600)
+	require.NoError(t, err)
+
+	// Переменные окружения переопределяют файл, флаги - переменные окружения
+	t.Setenv("POSTGRES_HOST", "db-from-env")
+	t.Setenv("KAFKA_ADDRESS", "kafka1:29091, kafka2:29092")
+	t.Setenv("KAFKA_CONSUMER_WORKERS", "8")
+	t.Setenv("POPULARITY_CART_ADD_WEIGHT", "12.5")
+
+	cfg, args, err := config.Load(testDefaults(), []string{"-config", path, "-kafka-workers", "16", "migrate", "status"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"migrate", "status"}, args)
+
+	require.Equal(t, ":9000", cfg.HTTP.Addr)
+	require.Equal(t, "db-from-env", cfg.Postgres.Host)
+	require.Equal(t, "file-user", cfg.Postgres.User)
+	require.Equal(t, "postgres", cfg.Postgres.DB)
+	require.Equal(t, []string{"kafka1:29091", "kafka2:29092"}, cfg.Kafka.Brokers)
+	require.Equal(t, 16, cfg.Kafka.Workers)
+	require.Equal(t, 50*time.Millisecond, cfg.Kafka.Producer.Linger)
+	require.Equal(t, "lz4", cfg.Kafka.Producer.Compression)
+	require.Equal(t, 12.5, cfg.Popularity.CartAddWeight)
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := map[string]struct {
+		env  map[string]string
+		args []string
+	}{
+		"invalid number":      {env: map[string]string{"KAFKA_CONSUMER_WORKERS": "many"}},
+		"invalid duration":    {args: []string{"-shutdown-timeout", "soon"}},
+		"unknown compression": {env: map[string]string{"KAFKA_PRODUCER_COMPRESSION": "brotli"}},
+		"invalid broker":      {env: map[string]string{"KAFKA_ADDRESS": "kafka1"}},
+		"invalid port":        {env: map[string]string{"POSTGRES_PORT": "postgres"}},
+		"unknown flag":        {args: []string{"-unknown", "1"}},
+		"negative weight":     {env: map[string]string{"POPULARITY_CART_ADD_WEIGHT": "-1"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, _, err := config.Load(testDefaults(), tt.args)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("postgres:\n  hots: localhost\n"), 0o600))
+
+	_, _, err := config.Load(testDefaults(), []string{"-config", path})
+	require.ErrorContains(t, err, "hots")
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	cfg := testDefaults()
+	cfg.Postgres.Password = "postgres-secret"
+	cfg.Redis.Password = "redis-secret"
+
+	out := cfg.String()
+	require.NotContains(t, out, "postgres-secret")
+	require.NotContains(t, out, "redis-secret")
+	require.Contains(t, out, "host: localhost")
+
+	// Исходная конфигурация не изменяется
+	require.Equal(t, "postgres-secret", cfg.Postgres.Password)
+}
@@ -1,11 +1,17 @@
 package db
 
 import (
+	"context"
+	"embed"
 	"fmt"
+	"io/fs"
 	"log"
 
+	"Go-internship-Manifure/internal/config"
+	ledger "Go-internship-Manifure/internal/db/ledger_db"
+	postgres "Go-internship-Manifure/internal/db/postgres_db"
+	"Go-internship-Manifure/internal/migrate"
 	"Go-internship-Manifure/internal/model"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -14,33 +20,52 @@ type DatabaseAnalyticsInterface interface {
 	MigrateAnalyticsModels() error
 }
 
-type Database struct {
-	Conn *gorm.DB
+// Таблица журнала обработанных событий сервиса.
+const ledgerTable = "analytics_processed_events"
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Версионированные миграции схемы postgres.
+func MigrationFiles() fs.FS {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
 }
 
-// Соединение с базой данных postgres через gorm.
-func NewAnalyticsDatabase(host, user, password, dbname, port string) *Database {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable", host, user, password, dbname, port)
+type AnalyticsDatabase struct {
+	Conn       *gorm.DB
+	Ledger     *ledger.Ledger
+	Migrations *migrate.Migrator // Схема postgres, у баз SQLite - nil
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// Соединение с базой данных postgres по настройкам cfg. Возвращает ошибку,
+// если база недоступна. Схема создается миграциями из каталога migrations.
+func NewAnalyticsDatabase(ctx context.Context, cfg config.Postgres) (*AnalyticsDatabase, error) {
+	db, err := postgres.Open(ctx, cfg, gorm.Config{})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return nil, err
 	}
 
-	database := &Database{Conn: db}
+	database := &AnalyticsDatabase{Conn: db, Ledger: ledger.NewLedger(db, ledgerTable)}
+
+	// Миграции применяются отдельно, см. App.Migrate
+	if database.Migrations, err = migrate.New(db, "analytics", MigrationFiles()); err != nil {
+		_ = database.CloseAnalyticsDB()
 
-	// авто миграция, если таблицы не существует
-	if err = database.MigrateAnalyticsModels(); err != nil {
-		log.Fatalf("Failed to migrate models: %v", err)
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
 	}
 
 	log.Println("Successfully connected to database")
 
-	return &Database{Conn: db}
+	return database, nil
 }
 
 // CloseAnalyticsDB Close закрывает базу данных.
-func (db *Database) CloseAnalyticsDB() error {
+func (db *AnalyticsDatabase) CloseAnalyticsDB() error {
 	log.Println("Closing database connection...")
 	sqlDB, err := db.Conn.DB()
 	if err != nil {
@@ -49,7 +74,12 @@ func (db *Database) CloseAnalyticsDB() error {
 	return sqlDB.Close()
 }
 
-// MigrateAnalyticsModels выполняет миграцию моделей.
-func (db *Database) MigrateAnalyticsModels() error {
-	return db.Conn.AutoMigrate(&model.UserStatistics{}, &model.ProductStatistics{})
+// MigrateAnalyticsModels создает схему через AutoMigrate, используется для баз SQLite
+// в тестах. Схема postgres управляется миграциями.
+func (db *AnalyticsDatabase) MigrateAnalyticsModels() error {
+	if err := db.Conn.AutoMigrate(&model.UserStatistics{}, &model.ProductStatistics{}); err != nil {
+		return err
+	}
+
+	return db.Ledger.Migrate()
 }
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS analytics_processed_events;
+DROP TABLE IF EXISTS product_statistics;
+DROP TABLE IF EXISTS user_statistics;
@@ -0,0 +1,23 @@
+-- Исходная схема сервиса аналитики. IF NOT EXISTS позволяет принять базы,
+-- созданные AutoMigrate до перехода на миграции.
+CREATE TABLE IF NOT EXISTS user_statistics (
+    user_id        TEXT PRIMARY KEY,
+    activity_count BIGINT DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS product_statistics (
+    product_id   TEXT PRIMARY KEY,
+    update_count BIGINT DEFAULT 0,
+    deleted_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_statistics_deleted_at ON product_statistics (deleted_at);
+
+CREATE TABLE IF NOT EXISTS analytics_processed_events (
+    event_id     TEXT PRIMARY KEY,
+    type         TEXT NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_analytics_processed_events_processed_at
+    ON analytics_processed_events (processed_at);
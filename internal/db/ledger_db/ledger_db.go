@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"Go-internship-Manifure/internal/model"
+	"Go-internship-Manifure/internal/monitoring"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Журнал обработанных событий сервиса. Kafka доставляет сообщения как минимум
+// один раз, журнал позволяет применять каждое событие только один раз.
+type Ledger struct {
+	Conn  *gorm.DB
+	Table string
+}
+
+// Создает журнал поверх таблицы с указанным именем.
+func NewLedger(conn *gorm.DB, table string) *Ledger {
+	return &Ledger{Conn: conn, Table: table}
+}
+
+// Создает таблицу и индекс по времени обработки для очистки старых записей.
+func (l *Ledger) Migrate() error {
+	if err := l.Conn.Table(l.Table).AutoMigrate(&model.ProcessedEvent{}); err != nil {
+		return fmt.Errorf("failed to migrate processed events: %w", err)
+	}
+
+	index := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_processed_at ON %[1]s (processed_at)", l.Table)
+	if err := l.Conn.Exec(index).Error; err != nil {
+		return fmt.Errorf("failed to create processed events index: %w", err)
+	}
+
+	return nil
+}
+
+// Записывает событие в журнал в рамках транзакции tx. Возвращает false,
+// если событие уже было обработано.
+func (l *Ledger) Record(tx *gorm.DB, event *model.Event) (bool, error) {
+	processed := model.ProcessedEvent{
+		EventID:     event.EventID,
+		Type:        event.Type,
+		ProcessedAt: time.Now().UTC(),
+	}
+
+	result := tx.Table(l.Table).Clauses(clause.OnConflict{DoNothing: true}).Create(&processed)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record processed event: %w", result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// Применяет событие один раз: apply выполняется в одной транзакции с записью
+// в журнал, а уже обработанное событие пропускается.
+func (l *Ledger) Apply(event *model.Event, apply func(tx *gorm.DB) error) error {
+	return l.Conn.Transaction(func(tx *gorm.DB) error {
+		fresh, err := l.Record(tx, event)
+		if err != nil {
+			return err
+		}
+
+		if !fresh {
+			log.Printf("Skipping already processed event %s of type %s", event.EventID, event.Type)
+			monitoring.DuplicateEventsTotal.WithLabelValues(l.Table).Inc()
+
+			return nil
+		}
+
+		return apply(tx)
+	})
+}
+
+// Удаляет записи, обработанные раньше before.
+func (l *Ledger) Prune(before time.Time) (int64, error) {
+	result := l.Conn.Table(l.Table).Where("processed_at < ?", before).Delete(&model.ProcessedEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune processed events: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// Периодически удаляет записи старше retention до отмены контекста.
+// retention должен быть больше срока хранения сообщений в kafka, иначе
+// повторно доставленное событие будет применено снова.
+func (l *Ledger) RunRetention(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := l.Prune(time.Now().UTC().Add(-retention))
+		if err != nil {
+			log.Printf("Failed to prune %s: %v", l.Table, err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d processed events from %s", pruned, l.Table)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
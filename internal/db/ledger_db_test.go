@@ -0,0 +1,75 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/db/ledger_db"
+	"Go-internship-Manifure/internal/model"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupLedger(t *testing.T) *db.Ledger {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	sqlDB, err := conn.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	ledger := db.NewLedger(conn, "processed_events")
+	require.NoError(t, ledger.Migrate())
+
+	return ledger
+}
+
+func TestLedgerAppliesEventOnce(t *testing.T) {
+	ledger := setupLedger(t)
+
+	event, err := model.NewEvent(model.ProductUpdated, "product-service", map[string]string{"id": "1"})
+	require.NoError(t, err)
+
+	// Ошибка обработки откатывает запись в журнале, событие будет применено при повторе
+	errApply := errors.New("database unavailable")
+	require.ErrorIs(t, ledger.Apply(event, func(*gorm.DB) error { return errApply }), errApply)
+
+	applied := 0
+	for range 2 {
+		require.NoError(t, ledger.Apply(event, func(*gorm.DB) error {
+			applied++
+
+			return nil
+		}))
+	}
+
+	require.Equal(t, 1, applied)
+}
+
+func TestLedgerPrune(t *testing.T) {
+	ledger := setupLedger(t)
+
+	event, err := model.NewEvent(model.ProductUpdated, "product-service", map[string]string{"id": "1"})
+	require.NoError(t, err)
+
+	fresh, err := ledger.Record(ledger.Conn, event)
+	require.NoError(t, err)
+	require.True(t, fresh)
+
+	pruned, err := ledger.Prune(time.Now().UTC().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+
+	pruned, err = ledger.Prune(time.Now().UTC().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), pruned)
+
+	// После очистки событие снова считается новым
+	fresh, err = ledger.Record(ledger.Conn, event)
+	require.NoError(t, err)
+	require.True(t, fresh)
+}
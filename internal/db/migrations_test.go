@@ -0,0 +1,35 @@
+package db_test
+
+import (
+	"io/fs"
+	"testing"
+
+	analytics "Go-internship-Manifure/internal/db/analytics_db"
+	product "Go-internship-Manifure/internal/db/product_db"
+	recommendation "Go-internship-Manifure/internal/db/recommendation_db"
+	user "Go-internship-Manifure/internal/db/user_db"
+	"Go-internship-Manifure/internal/migrate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceMigrationsAreValid(t *testing.T) {
+	services := map[string]fs.FS{
+		"user":           user.MigrationFiles(),
+		"product":        product.MigrationFiles(),
+		"recommendation": recommendation.MigrationFiles(),
+		"analytics":      analytics.MigrationFiles(),
+	}
+
+	for name, files := range services {
+		t.Run(name, func(t *testing.T) {
+			migrations, err := migrate.Load(files)
+			require.NoError(t, err)
+			require.NotEmpty(t, migrations)
+
+			// Версии идут подряд с единицы
+			for i, m := range migrations {
+				require.EqualValues(t, i+1, m.Version, m.Name)
+			}
+		})
+	}
+}
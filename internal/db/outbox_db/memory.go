@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"Go-internship-Manifure/internal/model"
+)
+
+// Outbox в памяти, используется хранилищами в памяти и в тестах.
+type MemoryOutbox struct {
+	messages []model.OutboxMessage
+	nextID   uint64
+	mu       sync.Mutex
+}
+
+// Создает пустой outbox в памяти.
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+// Добавляет сообщения в outbox.
+func (o *MemoryOutbox) Enqueue(messages ...model.OutboxMessage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, message := range messages {
+		o.nextID++
+		message.ID = o.nextID
+		message.CreatedAt = now
+		o.messages = append(o.messages, message)
+	}
+}
+
+// Outbox в памяти принадлежит одному процессу, блокировка всегда захвачена.
+func (o *MemoryOutbox) ClaimRelay(context.Context) (bool, error) {
+	return true, nil
+}
+
+func (o *MemoryOutbox) ReleaseRelay() {}
+
+// Возвращает неотправленные сообщения в порядке добавления.
+func (o *MemoryOutbox) PendingMessages(limit int) ([]model.OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var pending []model.OutboxMessage
+
+	for _, message := range o.messages {
+		if len(pending) == limit {
+			break
+		}
+
+		if message.SentAt == nil {
+			pending = append(pending, message)
+		}
+	}
+
+	return pending, nil
+}
+
+// Отмечает сообщение отправленным.
+func (o *MemoryOutbox) MarkSent(id uint64) error {
+	return o.update(id, func(message *model.OutboxMessage) {
+		now := time.Now().UTC()
+		message.SentAt = &now
+		message.Attempts++
+	})
+}
+
+// Сохраняет неудачную попытку отправки.
+func (o *MemoryOutbox) MarkFailed(id uint64, cause error) error {
+	return o.update(id, func(message *model.OutboxMessage) {
+		message.Attempts++
+		message.LastError = cause.Error()
+	})
+}
+
+// Время добавления самого старого неотправленного сообщения.
+func (o *MemoryOutbox) OldestPending() (time.Time, bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, message := range o.messages {
+		if message.SentAt == nil {
+			return message.CreatedAt, true, nil
+		}
+	}
+
+	return time.Time{}, false, nil
+}
+
+func (o *MemoryOutbox) update(id uint64, modify func(message *model.OutboxMessage)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.messages {
+		if o.messages[i].ID == id {
+			modify(&o.messages[i])
+
+			return nil
+		}
+	}
+
+	return errors.New("outbox message not found")
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"Go-internship-Manifure/internal/model"
+	"gorm.io/gorm"
+)
+
+// Таблица outbox сервиса. Сообщения добавляются в транзакции, в которой
+// изменяется сущность, и отправляются в kafka фоновым процессом.
+type Outbox struct {
+	Conn  *gorm.DB
+	Table string
+
+	relayConn *sql.Conn // Соединение, на котором удерживается блокировка relay
+	mu        sync.Mutex
+}
+
+// Создает outbox поверх таблицы с указанным именем.
+func NewOutbox(conn *gorm.DB, table string) *Outbox {
+	return &Outbox{Conn: conn, Table: table}
+}
+
+// Создает таблицу и частичные индексы по неотправленным сообщениям и по
+// времени отправки для очистки отправленных.
+func (o *Outbox) Migrate() error {
+	if err := o.Conn.Table(o.Table).AutoMigrate(&model.OutboxMessage{}); err != nil {
+		return fmt.Errorf("failed to migrate outbox: %w", err)
+	}
+
+	index := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_pending ON %[1]s (id) WHERE sent_at IS NULL", o.Table)
+	if err := o.Conn.Exec(index).Error; err != nil {
+		return fmt.Errorf("failed to create outbox index: %w", err)
+	}
+
+	index = fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_sent_at ON %[1]s (sent_at) WHERE sent_at IS NOT NULL", o.Table)
+	if err := o.Conn.Exec(index).Error; err != nil {
+		return fmt.Errorf("failed to create outbox index: %w", err)
+	}
+
+	return nil
+}
+
+// Добавляет сообщения в outbox в рамках транзакции tx.
+func (o *Outbox) Enqueue(tx *gorm.DB, messages ...model.OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	for i := range messages {
+		messages[i].CreatedAt = now
+	}
+
+	if err := tx.Table(o.Table).Create(&messages).Error; err != nil {
+		return fmt.Errorf("failed to enqueue outbox messages: %w", err)
+	}
+
+	return nil
+}
+
+// Захватывает право отправлять сообщения outbox. Сообщения отправляются строго
+// по порядку, поэтому их отправляет одна реплика, удерживающая advisory lock
+// на отдельном соединении. Возвращает false, если блокировку держит другая реплика.
+func (o *Outbox) ClaimRelay(ctx context.Context) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// SQLite не поддерживает advisory lock, база используется одним процессом
+	if o.Conn.Dialector.Name() != "postgres" {
+		return true, nil
+	}
+
+	if o.relayConn != nil {
+		// Блокировка снимается при разрыве соединения, тогда ее может захватить другая реплика
+		if _, err := o.relayConn.ExecContext(ctx, "SELECT 1"); err != nil {
+			_ = o.relayConn.Close()
+			o.relayConn = nil
+
+			return false, fmt.Errorf("lost %s relay lock: %w", o.Table, err)
+		}
+
+		return true, nil
+	}
+
+	sqlDB, err := o.Conn.DB()
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve *sql.DB: %w", err)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", o.lockKey()).Scan(&locked); err != nil {
+		_ = conn.Close()
+
+		return false, fmt.Errorf("failed to acquire %s relay lock: %w", o.Table, err)
+	}
+
+	if !locked {
+		_ = conn.Close()
+
+		return false, nil
+	}
+
+	o.relayConn = conn
+
+	return true, nil
+}
+
+// Снимает блокировку relay, если она захвачена.
+func (o *Outbox) ReleaseRelay() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.relayConn == nil {
+		return
+	}
+
+	// Контекст relay уже отменен, блокировку все равно нужно снять
+	if _, err := o.relayConn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", o.lockKey()); err != nil {
+		log.Printf("Failed to release %s relay lock: %v", o.Table, err)
+	}
+
+	_ = o.relayConn.Close()
+	o.relayConn = nil
+}
+
+// Ключ advisory lock, одинаковый у всех реплик сервиса.
+func (o *Outbox) lockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("outbox_relay:" + o.Table))
+
+	return int64(h.Sum64())
+}
+
+// Возвращает неотправленные сообщения в порядке добавления.
+func (o *Outbox) PendingMessages(limit int) ([]model.OutboxMessage, error) {
+	var messages []model.OutboxMessage
+
+	err := o.Conn.Table(o.Table).Where("sent_at IS NULL").Order("id").Limit(limit).Find(&messages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending outbox messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// Отмечает сообщение отправленным.
+func (o *Outbox) MarkSent(id uint64) error {
+	err := o.Conn.Table(o.Table).Where("id = ?", id).Updates(map[string]interface{}{
+		"sent_at":  time.Now().UTC(),
+		"attempts": gorm.Expr("attempts + 1"),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox message as sent: %w", err)
+	}
+
+	return nil
+}
+
+// Сохраняет неудачную попытку отправки.
+func (o *Outbox) MarkFailed(id uint64, cause error) error {
+	err := o.Conn.Table(o.Table).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": cause.Error(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox message as failed: %w", err)
+	}
+
+	return nil
+}
+
+// Время добавления самого старого неотправленного сообщения.
+func (o *Outbox) OldestPending() (time.Time, bool, error) {
+	var message model.OutboxMessage
+
+	err := o.Conn.Table(o.Table).Select("created_at").Where("sent_at IS NULL").Order("id").Take(&message).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, false, nil
+		}
+
+		return time.Time{}, false, fmt.Errorf("failed to get oldest outbox message: %w", err)
+	}
+
+	return message.CreatedAt, true, nil
+}
+
+// Удаляет сообщения, отправленные раньше before. Неотправленные сообщения не удаляются.
+func (o *Outbox) Prune(before time.Time) (int64, error) {
+	result := o.Conn.Table(o.Table).Where("sent_at IS NOT NULL AND sent_at < ?", before).Delete(&model.OutboxMessage{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// Периодически удаляет сообщения, отправленные раньше retention, до отмены контекста.
+func (o *Outbox) RunRetention(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := o.Prune(time.Now().UTC().Add(-retention))
+		if err != nil {
+			log.Printf("Failed to prune %s: %v", o.Table, err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d sent messages from %s", pruned, o.Table)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
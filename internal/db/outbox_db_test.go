@@ -0,0 +1,75 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/db/user_db"
+	"Go-internship-Manifure/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxWrittenInUserTransaction(t *testing.T) {
+	database, err := db.NewSQLiteUserDatabase(":memory:")
+	require.NoError(t, err)
+
+	message := model.OutboxMessage{Key: "1", Payload: []byte(`{}`)}
+
+	require.NoError(t, database.CreateUser(&model.User{ID: "1", Name: "John", Email: "john@example.com", PasswordHash: "1"}, message))
+
+	// Пользователь не создан, сообщение в outbox тоже не должно остаться
+	err = database.CreateUser(&model.User{ID: "2", Name: "Jane", Email: "john@example.com", PasswordHash: "2"}, message)
+	require.ErrorIs(t, err, db.ErrEmailTaken)
+
+	pending, err := database.Outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, "1", pending[0].Key)
+
+	require.NoError(t, database.Outbox.MarkFailed(pending[0].ID, errors.New("broker unavailable")))
+
+	oldest, ok, err := database.Outbox.OldestPending()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, pending[0].CreatedAt.Unix(), oldest.Unix())
+
+	require.NoError(t, database.Outbox.MarkSent(pending[0].ID))
+
+	pending, err = database.Outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	_, ok, err = database.Outbox.OldestPending()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestOutboxPrune(t *testing.T) {
+	database, err := db.NewSQLiteUserDatabase(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, database.CreateUser(&model.User{ID: "1", Name: "John", Email: "john@example.com", PasswordHash: "1"},
+		model.OutboxMessage{Key: "1", Payload: []byte(`{"sent":true}`)},
+		model.OutboxMessage{Key: "1", Payload: []byte(`{"sent":false}`)},
+	))
+
+	pending, err := database.Outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.NoError(t, database.Outbox.MarkSent(pending[0].ID))
+
+	pruned, err := database.Outbox.Prune(time.Now().UTC().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+
+	// Удаляется только отправленное сообщение
+	pruned, err = database.Outbox.Prune(time.Now().UTC().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), pruned)
+
+	pending, err = database.Outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.JSONEq(t, `{"sent":false}`, string(pending[0].Payload))
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"Go-internship-Manifure/internal/config"
+	"Go-internship-Manifure/internal/monitoring"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Открывает соединение с postgres по настройкам cfg: настраивает пул,
+// проверяет соединение, создает схему сервиса, если ее еще нет, и публикует
+// метрики пула. Соединение проверяется с учетом контекста.
+func Open(ctx context.Context, cfg config.Postgres, gormConfig gorm.Config) (*gorm.DB, error) {
+	gormConfig.DisableAutomaticPing = true
+
+	conn, err := gorm.Open(postgres.Open(DSN(cfg)), &gormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve *sql.DB: %w", err)
+	}
+
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err = sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if cfg.Schema != "" {
+		if err = ensureSchema(ctx, conn, cfg.Schema); err != nil {
+			_ = sqlDB.Close()
+
+			return nil, err
+		}
+	}
+
+	name := cfg.ApplicationName
+	if name == "" {
+		name = cfg.DB
+	}
+
+	if err = monitoring.RegisterDBStats(name, sqlDB); err != nil {
+		log.Printf("Failed to register database pool metrics: %v", err)
+	}
+
+	return conn, nil
+}
+
+// Строка подключения в формате key=value. Схема сервиса передается как
+// search_path, поэтому таблицы и schema_migrations создаются в ней.
+func DSN(cfg config.Postgres) string {
+	params := [][2]string{
+		{"host", cfg.Host},
+		{"port", cfg.Port},
+		{"user", cfg.User},
+		{"password", cfg.Password},
+		{"dbname", cfg.DB},
+		{"sslmode", cfg.SSLMode},
+		{"sslrootcert", cfg.SSLRootCert},
+		{"application_name", cfg.ApplicationName},
+		{"search_path", cfg.Schema},
+	}
+
+	// connect_timeout задается в целых секундах, 0 - без ограничения
+	if cfg.ConnectTimeout > 0 {
+		seconds := max(int(cfg.ConnectTimeout.Seconds()), 1)
+		params = append(params, [2]string{"connect_timeout", strconv.Itoa(seconds)})
+	}
+
+	var b strings.Builder
+
+	for _, p := range params {
+		if p[1] == "" {
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+
+		b.WriteString(p[0])
+		b.WriteByte('=')
+		b.WriteString(quoteValue(p[1]))
+	}
+
+	return b.String()
+}
+
+// Экранирует значение DSN: значения с пробелами и кавычками заключаются в кавычки.
+func quoteValue(value string) string {
+	if !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+
+	return "'" + value + "'"
+}
+
+// Создает схему сервиса, если ее нет. Обычно схему заранее создает
+// администратор вместе с пользователем сервиса, тогда права на создание
+// схем в базе пользователю не нужны.
+func ensureSchema(ctx context.Context, conn *gorm.DB, schema string) error {
+	var exists bool
+
+	err := conn.WithContext(ctx).Raw("SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = ?)", schema).Scan(&exists).Error
+	if err != nil {
+		return fmt.Errorf("failed to check schema %s: %w", schema, err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	quoted := `"` + strings.ReplaceAll(schema, `"`, `""`) + `"`
+	if err := conn.WithContext(ctx).Exec("CREATE SCHEMA IF NOT EXISTS " + quoted).Error; err != nil {
+		return fmt.Errorf("failed to create schema %s: %w", schema, err)
+	}
+
+	log.Printf("Created database schema %s", schema)
+
+	return nil
+}
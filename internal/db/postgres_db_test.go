@@ -0,0 +1,33 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/config"
+	postgres "Go-internship-Manifure/internal/db/postgres_db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDSN(t *testing.T) {
+	cfg := config.Default().Postgres
+	cfg.Password = "it's a secret"
+	cfg.Schema = "recommendation"
+	cfg.ApplicationName = "recommendation-service"
+	cfg.ConnectTimeout = 1500 * time.Millisecond
+
+	require.Equal(t,
+		`host=localhost port=5432 user=postgres password='it\'s a secret' dbname=postgres sslmode=disable `+
+			`application_name=recommendation-service search_path=recommendation connect_timeout=1`,
+		postgres.DSN(cfg))
+
+	// Пустые параметры не передаются
+	cfg = config.Default().Postgres
+	cfg.SSLMode = "verify-full"
+	cfg.SSLRootCert = "/etc/ssl/root.crt"
+	cfg.ConnectTimeout = 0
+
+	require.Equal(t,
+		"host=localhost port=5432 user=postgres password=1 dbname=postgres sslmode=verify-full sslrootcert=/etc/ssl/root.crt",
+		postgres.DSN(cfg))
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"Go-internship-Manifure/internal/model"
+)
+
+const (
+	SortByID    = "id"
+	SortByPrice = "price"
+	SortByViews = "views"
+
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Параметры выборки списка продуктов.
+type ListFilter struct {
+	Query    string   // подстрока в названии, без учета регистра
+	MinPrice *float32 // нижняя граница цены включительно
+	MaxPrice *float32 // верхняя граница цены включительно
+	SortBy   string   // SortByID, SortByPrice или SortByViews
+	Desc     bool
+	Limit    int
+	Cursor   string // значение next_cursor из предыдущей страницы
+}
+
+// Позиция последнего элемента страницы, от которой продолжается выборка.
+type cursor struct {
+	SortBy string  `json:"s"`
+	Desc   bool    `json:"d"`
+	Price  float32 `json:"p,omitempty"`
+	Views  int64   `json:"v,omitempty"`
+	ID     string  `json:"id"`
+}
+
+// Приводит фильтр к допустимым значениям.
+func (f ListFilter) normalize() (ListFilter, error) {
+	switch f.SortBy {
+	case "":
+		f.SortBy = SortByID
+	case SortByID, SortByPrice, SortByViews:
+	default:
+		return f, fmt.Errorf("unsupported sort field: %s", f.SortBy)
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultListLimit
+	}
+
+	if f.Limit > MaxListLimit {
+		f.Limit = MaxListLimit
+	}
+
+	f.Query = strings.ToLower(f.Query)
+
+	return f, nil
+}
+
+// Декодирует курсор и проверяет, что он выдан для той же сортировки.
+func (f ListFilter) decodeCursor() (cursor, bool, error) {
+	var c cursor
+
+	if f.Cursor == "" {
+		return c, false, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return c, false, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" {
+		return c, false, ErrInvalidCursor
+	}
+
+	if c.SortBy != f.SortBy || c.Desc != f.Desc {
+		return c, false, ErrInvalidCursor
+	}
+
+	return c, true, nil
+}
+
+// Формирует курсор на следующую страницу, если она может существовать.
+func (f ListFilter) nextCursor(page []model.Product) string {
+	if len(page) < f.Limit {
+		return ""
+	}
+
+	last := page[len(page)-1]
+
+	return cursor{SortBy: f.SortBy, Desc: f.Desc, Price: last.Price, Views: last.Views, ID: last.ID}.encode()
+}
+
+// Значение поля сортировки, сохраненное в курсоре.
+func (c cursor) value() interface{} {
+	switch c.SortBy {
+	case SortByPrice:
+		return c.Price
+	case SortByViews:
+		return c.Views
+	default:
+		return c.ID
+	}
+}
+
+// Сравнивает продукты в порядке сортировки фильтра, id используется как второй ключ.
+func (f ListFilter) compare(a, b model.Product) int {
+	var c int
+
+	switch f.SortBy {
+	case SortByPrice:
+		c = cmp.Compare(a.Price, b.Price)
+	case SortByViews:
+		c = cmp.Compare(a.Views, b.Views)
+	}
+
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+
+	if f.Desc {
+		c = -c
+	}
+
+	return c
+}
+
+func (c cursor) encode() string {
+	raw, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Экранирует спецсимволы LIKE в поисковой строке.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
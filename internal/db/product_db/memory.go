@@ -0,0 +1,136 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	outbox "Go-internship-Manifure/internal/db/outbox_db"
+	"Go-internship-Manifure/internal/model"
+)
+
+// Хранилище продуктов в памяти, используется в тестах.
+type MemoryRepository struct {
+	Outbox *outbox.MemoryOutbox
+
+	products map[string]model.Product
+	mu       sync.RWMutex
+}
+
+// Создает пустое хранилище продуктов в памяти.
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		Outbox:   outbox.NewMemoryOutbox(),
+		products: make(map[string]model.Product),
+	}
+}
+
+// Сохраняет новый продукт.
+func (m *MemoryRepository) CreateProduct(product *model.Product, messages ...model.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.products[product.ID] = *product
+	m.Outbox.Enqueue(messages...)
+
+	return nil
+}
+
+// Возвращает копию продукта по id.
+func (m *MemoryRepository) GetProductByID(id string) (*model.Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	product, ok := m.products[id]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+
+	return &product, nil
+}
+
+// Возвращает страницу продуктов и курсор на следующую страницу.
+func (m *MemoryRepository) ListProducts(filter ListFilter) ([]model.Product, string, error) {
+	filter, err := filter.normalize()
+	if err != nil {
+		return nil, "", err
+	}
+
+	after, ok, err := filter.decodeCursor()
+	if err != nil {
+		return nil, "", err
+	}
+
+	m.mu.RLock()
+	products := make([]model.Product, 0, len(m.products))
+
+	for _, product := range m.products {
+		if filter.Query != "" && !strings.Contains(strings.ToLower(product.Name), filter.Query) {
+			continue
+		}
+
+		if filter.MinPrice != nil && product.Price < *filter.MinPrice {
+			continue
+		}
+
+		if filter.MaxPrice != nil && product.Price > *filter.MaxPrice {
+			continue
+		}
+
+		products = append(products, product)
+	}
+	m.mu.RUnlock()
+
+	slices.SortFunc(products, filter.compare)
+
+	// Пропуск элементов до курсора включительно
+	if ok {
+		last := model.Product{ID: after.ID, Price: after.Price, Views: after.Views}
+		start, found := slices.BinarySearchFunc(products, last, filter.compare)
+
+		if found {
+			start++
+		}
+
+		products = products[start:]
+	}
+
+	if len(products) > filter.Limit {
+		products = products[:filter.Limit]
+	}
+
+	return products, filter.nextCursor(products), nil
+}
+
+// Сохраняет изменения существующего продукта.
+func (m *MemoryRepository) UpdateProduct(product *model.Product, messages ...model.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.products[product.ID]
+	if !ok {
+		return ErrProductNotFound
+	}
+
+	existing.Name = product.Name
+	existing.Price = product.Price
+	m.products[product.ID] = existing
+	m.Outbox.Enqueue(messages...)
+
+	return nil
+}
+
+// Удаляет продукт по id.
+func (m *MemoryRepository) DeleteProduct(id string, messages ...model.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.products[id]; !ok {
+		return ErrProductNotFound
+	}
+
+	delete(m.products, id)
+	m.Outbox.Enqueue(messages...)
+
+	return nil
+}
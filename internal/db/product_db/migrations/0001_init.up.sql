@@ -0,0 +1,22 @@
+-- Исходная схема сервиса продуктов. IF NOT EXISTS позволяет принять базы,
+-- созданные AutoMigrate до перехода на миграции.
+CREATE TABLE IF NOT EXISTS products (
+    id    TEXT PRIMARY KEY,
+    name  TEXT NOT NULL,
+    price REAL DEFAULT 0,
+    views BIGINT DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS product_outbox (
+    id         BIGSERIAL PRIMARY KEY,
+    key        TEXT NOT NULL,
+    payload    BYTEA,
+    headers    TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    sent_at    TIMESTAMPTZ,
+    attempts   BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+-- Relay читает только неотправленные сообщения
+CREATE INDEX IF NOT EXISTS idx_product_outbox_pending ON product_outbox (id) WHERE sent_at IS NULL;
@@ -0,0 +1,2 @@
+-- Отправленные сообщения удаляются по времени отправки.
+CREATE INDEX IF NOT EXISTS idx_product_outbox_sent_at ON product_outbox (sent_at) WHERE sent_at IS NOT NULL;
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"Go-internship-Manifure/internal/config"
+	outbox "Go-internship-Manifure/internal/db/outbox_db"
+	postgres "Go-internship-Manifure/internal/db/postgres_db"
+	"Go-internship-Manifure/internal/migrate"
+	"Go-internship-Manifure/internal/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Таблица outbox сервиса продуктов.
+const outboxTable = "product_outbox"
+
+var ErrProductNotFound = errors.New("product not found")
+
+// Хранилище продуктов. Сообщения outbox сохраняются в одной транзакции с изменением.
+type ProductRepository interface {
+	CreateProduct(product *model.Product, messages ...model.OutboxMessage) error
+	GetProductByID(id string) (*model.Product, error)
+	ListProducts(filter ListFilter) ([]model.Product, string, error)
+	UpdateProduct(product *model.Product, messages ...model.OutboxMessage) error
+	DeleteProduct(id string, messages ...model.OutboxMessage) error
+}
+
+type DatabaseProductInterface interface {
+	CloseProductDB() error
+	MigrateProductModels() error
+}
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Версионированные миграции схемы postgres.
+func MigrationFiles() fs.FS {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
+
+type ProductDatabase struct {
+	Conn       *gorm.DB
+	Outbox     *outbox.Outbox
+	Migrations *migrate.Migrator // Схема postgres, у баз SQLite - nil
+}
+
+// Соединение с базой данных postgres по настройкам cfg. Возвращает ошибку,
+// если база недоступна. Схема создается миграциями из каталога migrations.
+func NewProductDatabase(ctx context.Context, cfg config.Postgres) (*ProductDatabase, error) {
+	db, err := postgres.Open(ctx, cfg, gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	database := &ProductDatabase{Conn: db, Outbox: outbox.NewOutbox(db, outboxTable)}
+
+	// Миграции применяются отдельно, см. App.Migrate
+	if database.Migrations, err = migrate.New(db, "product", MigrationFiles()); err != nil {
+		_ = database.CloseProductDB()
+
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	log.Println("Successfully connected to database")
+
+	return database, nil
+}
+
+// Создает хранилище продуктов поверх SQLite.
+func NewSQLiteProductDatabase(dsn string) (*ProductDatabase, error) {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// Для ":memory:" каждое соединение получает свою базу, поэтому пул ограничен одним соединением
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve *sql.DB: %w", err)
+	}
+
+	sqlDB.SetMaxOpenConns(1)
+
+	database := &ProductDatabase{Conn: db, Outbox: outbox.NewOutbox(db, outboxTable)}
+	if err = database.MigrateProductModels(); err != nil {
+		return nil, fmt.Errorf("failed to migrate models: %w", err)
+	}
+
+	return database, nil
+}
+
+// CloseProductDB закрывает базу данных.
+func (db *ProductDatabase) CloseProductDB() error {
+	log.Println("Closing database connection...")
+	sqlDB, err := db.Conn.DB()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve *sql.DB: %w", err)
+	}
+	return sqlDB.Close()
+}
+
+// MigrateProductModels создает схему через AutoMigrate, используется для баз SQLite
+// в тестах. Схема postgres управляется миграциями.
+func (db *ProductDatabase) MigrateProductModels() error {
+	if err := db.Conn.AutoMigrate(&model.Product{}); err != nil {
+		return err
+	}
+
+	return db.Outbox.Migrate()
+}
+
+// Сохраняет новый продукт.
+func (db *ProductDatabase) CreateProduct(product *model.Product, messages ...model.OutboxMessage) error {
+	return db.Conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return fmt.Errorf("failed to create product: %w", err)
+		}
+
+		return db.Outbox.Enqueue(tx, messages...)
+	})
+}
+
+// Возвращает продукт по id.
+func (db *ProductDatabase) GetProductByID(id string) (*model.Product, error) {
+	var product model.Product
+	if err := db.Conn.Where("id = ?", id).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return &product, nil
+}
+
+// Возвращает страницу продуктов и курсор на следующую страницу.
+func (db *ProductDatabase) ListProducts(filter ListFilter) ([]model.Product, string, error) {
+	filter, err := filter.normalize()
+	if err != nil {
+		return nil, "", err
+	}
+
+	after, ok, err := filter.decodeCursor()
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := db.Conn.Model(&model.Product{})
+
+	if filter.Query != "" {
+		query = query.Where(`LOWER(name) LIKE ? ESCAPE '\'`, "%"+escapeLike(filter.Query)+"%")
+	}
+
+	if filter.MinPrice != nil {
+		query = query.Where("price >= ?", *filter.MinPrice)
+	}
+
+	if filter.MaxPrice != nil {
+		query = query.Where("price <= ?", *filter.MaxPrice)
+	}
+
+	direction, op := "ASC", ">"
+	if filter.Desc {
+		direction, op = "DESC", "<"
+	}
+
+	// Продолжение выборки после последнего элемента предыдущей страницы
+	if ok {
+		if filter.SortBy == SortByID {
+			query = query.Where("id "+op+" ?", after.ID)
+		} else {
+			query = query.Where(
+				fmt.Sprintf("(%[1]s %[2]s ?) OR (%[1]s = ? AND id %[2]s ?)", filter.SortBy, op),
+				after.value(), after.value(), after.ID,
+			)
+		}
+	}
+
+	if filter.SortBy != SortByID {
+		query = query.Order(filter.SortBy + " " + direction)
+	}
+
+	var products []model.Product
+	if err := query.Order("id " + direction).Limit(filter.Limit).Find(&products).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to list products: %w", err)
+	}
+
+	return products, filter.nextCursor(products), nil
+}
+
+// Сохраняет изменения существующего продукта.
+func (db *ProductDatabase) UpdateProduct(product *model.Product, messages ...model.OutboxMessage) error {
+	return db.Conn.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Product{}).Where("id = ?", product.ID).Updates(map[string]interface{}{
+			"name":  product.Name,
+			"price": product.Price,
+		})
+		if res.Error != nil {
+			return fmt.Errorf("failed to update product: %w", res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrProductNotFound
+		}
+
+		return db.Outbox.Enqueue(tx, messages...)
+	})
+}
+
+// Удаляет продукт по id.
+func (db *ProductDatabase) DeleteProduct(id string, messages ...model.OutboxMessage) error {
+	return db.Conn.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&model.Product{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete product: %w", res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrProductNotFound
+		}
+
+		return db.Outbox.Enqueue(tx, messages...)
+	})
+}
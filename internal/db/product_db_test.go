@@ -0,0 +1,93 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"Go-internship-Manifure/internal/db/product_db"
+	"Go-internship-Manifure/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func productRepositories(t *testing.T) map[string]db.ProductRepository {
+	t.Helper()
+
+	database, err := db.NewSQLiteProductDatabase(":memory:")
+	require.NoError(t, err)
+
+	return map[string]db.ProductRepository{
+		"gorm":   database,
+		"memory": db.NewMemoryRepository(),
+	}
+}
+
+// Собирает все страницы выборки, следуя по next_cursor.
+func listAll(t *testing.T, repo db.ProductRepository, filter db.ListFilter) []string {
+	t.Helper()
+
+	var ids []string
+
+	for {
+		page, next, err := repo.ListProducts(filter)
+		require.NoError(t, err)
+
+		for _, product := range page {
+			ids = append(ids, product.ID)
+		}
+
+		if next == "" {
+			return ids
+		}
+
+		filter.Cursor = next
+	}
+}
+
+func TestListProductsPagination(t *testing.T) {
+	for name, repo := range productRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			// Одинаковые цены проверяют устойчивость курсора при равных значениях сортировки
+			for i := range 7 {
+				product := model.Product{
+					ID:    fmt.Sprintf("p%d", i),
+					Name:  fmt.Sprintf("Phone %d", i),
+					Price: float32(10 * (i % 3)),
+					Views: int64(i),
+				}
+				require.NoError(t, repo.CreateProduct(&product))
+			}
+
+			require.NoError(t, repo.CreateProduct(&model.Product{ID: "x", Name: "Laptop", Price: 15, Views: 100}))
+
+			byPrice := listAll(t, repo, db.ListFilter{Query: "phone", SortBy: db.SortByPrice, Limit: 2})
+			require.Equal(t, []string{"p0", "p3", "p6", "p1", "p4", "p2", "p5"}, byPrice)
+
+			byViews := listAll(t, repo, db.ListFilter{SortBy: db.SortByViews, Desc: true, Limit: 3})
+			require.Equal(t, []string{"x", "p6", "p5", "p4", "p3", "p2", "p1", "p0"}, byViews)
+
+			minPrice, maxPrice := float32(10), float32(15)
+			inRange := listAll(t, repo, db.ListFilter{MinPrice: &minPrice, MaxPrice: &maxPrice})
+			require.Equal(t, []string{"p1", "p4", "x"}, inRange)
+		})
+	}
+}
+
+func TestListProductsInvalidCursor(t *testing.T) {
+	for name, repo := range productRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, repo.CreateProduct(&model.Product{ID: "a", Name: "A"}))
+			require.NoError(t, repo.CreateProduct(&model.Product{ID: "b", Name: "B"}))
+
+			_, next, err := repo.ListProducts(db.ListFilter{SortBy: db.SortByPrice, Limit: 1})
+			require.NoError(t, err)
+			require.NotEmpty(t, next)
+
+			// Курсор нельзя использовать с другой сортировкой
+			_, _, err = repo.ListProducts(db.ListFilter{SortBy: db.SortByViews, Cursor: next})
+			require.ErrorIs(t, err, db.ErrInvalidCursor)
+
+			_, _, err = repo.ListProducts(db.ListFilter{Cursor: "garbage"})
+			require.ErrorIs(t, err, db.ErrInvalidCursor)
+		})
+	}
+}
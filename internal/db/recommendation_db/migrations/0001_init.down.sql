@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS recommendation_processed_events;
+DROP TABLE IF EXISTS recommendations;
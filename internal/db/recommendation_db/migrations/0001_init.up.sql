@@ -0,0 +1,17 @@
+-- Исходная схема сервиса рекомендаций. IF NOT EXISTS позволяет принять базы,
+-- созданные AutoMigrate до перехода на миграции.
+CREATE TABLE IF NOT EXISTS recommendations (
+    id               TEXT PRIMARY KEY,
+    name             TEXT NOT NULL,
+    price            REAL DEFAULT 0,
+    popularity_score BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recommendation_processed_events (
+    event_id     TEXT PRIMARY KEY,
+    type         TEXT NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_recommendation_processed_events_processed_at
+    ON recommendation_processed_events (processed_at);
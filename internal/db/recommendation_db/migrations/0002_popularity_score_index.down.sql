@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_recommendations_popularity_score;
@@ -0,0 +1,3 @@
+-- Список рекомендаций читается по убыванию популярности.
+CREATE INDEX IF NOT EXISTS idx_recommendations_popularity_score
+    ON recommendations (popularity_score DESC);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_recommendations_score;
+
+CREATE INDEX IF NOT EXISTS idx_recommendations_popularity_score
+    ON recommendations (popularity_score DESC);
+
+DROP TABLE IF EXISTS popularity_epoch;
+
+ALTER TABLE recommendations DROP COLUMN IF EXISTS score;
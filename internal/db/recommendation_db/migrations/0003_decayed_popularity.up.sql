@@ -0,0 +1,18 @@
+-- Популярность с затуханием. score хранится в масштабе эпохи из popularity_epoch,
+-- накопленные до миграции события учитываются с весом 1 на момент миграции.
+ALTER TABLE recommendations ADD COLUMN IF NOT EXISTS score DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+UPDATE recommendations SET score = popularity_score;
+
+CREATE TABLE IF NOT EXISTS popularity_epoch (
+    id    BIGINT PRIMARY KEY,
+    epoch TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO popularity_epoch (id, epoch) VALUES (1, NOW()) ON CONFLICT DO NOTHING;
+
+-- Список рекомендаций читается по убыванию score.
+DROP INDEX IF EXISTS idx_recommendations_popularity_score;
+
+CREATE INDEX IF NOT EXISTS idx_recommendations_score
+    ON recommendations (score DESC, popularity_score DESC);
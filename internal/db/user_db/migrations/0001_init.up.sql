@@ -0,0 +1,26 @@
+-- Исходная схема сервиса пользователей. IF NOT EXISTS позволяет принять базы,
+-- созданные AutoMigrate до перехода на миграции.
+CREATE TABLE IF NOT EXISTS users (
+    id            TEXT PRIMARY KEY,
+    name          TEXT NOT NULL,
+    email         TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role          TEXT NOT NULL DEFAULT 'user',
+    cart          TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS user_outbox (
+    id         BIGSERIAL PRIMARY KEY,
+    key        TEXT NOT NULL,
+    payload    BYTEA,
+    headers    TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    sent_at    TIMESTAMPTZ,
+    attempts   BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+-- Relay читает только неотправленные сообщения
+CREATE INDEX IF NOT EXISTS idx_user_outbox_pending ON user_outbox (id) WHERE sent_at IS NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_user_outbox_sent_at;
@@ -0,0 +1,234 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"Go-internship-Manifure/internal/config"
+	outbox "Go-internship-Manifure/internal/db/outbox_db"
+	postgres "Go-internship-Manifure/internal/db/postgres_db"
+	"Go-internship-Manifure/internal/migrate"
+	"Go-internship-Manifure/internal/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Таблица outbox сервиса пользователей.
+const outboxTable = "user_outbox"
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailTaken   = errors.New("email already registered")
+)
+
+// Хранилище пользователей. Сообщения outbox сохраняются в одной транзакции с изменением.
+type UserRepository interface {
+	CreateUser(user *model.User, messages ...model.OutboxMessage) error
+	GetUserByID(id string) (*model.User, error)
+	GetUserByEmail(email string) (*model.User, error)
+	UpdateUser(user *model.User, messages ...model.OutboxMessage) error
+	UpdateCart(id string, modify CartModifier) (*model.User, error)
+}
+
+// Изменяет корзину и возвращает сообщения outbox об изменении.
+type CartModifier func(cart []model.CartItem) ([]model.CartItem, []model.OutboxMessage, error)
+
+type DatabaseUserInterface interface {
+	CloseUserDB() error
+	MigrateUserModels() error
+}
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Версионированные миграции схемы postgres.
+func MigrationFiles() fs.FS {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
+
+type UserDatabase struct {
+	Conn       *gorm.DB
+	Outbox     *outbox.Outbox
+	Migrations *migrate.Migrator // Схема postgres, у баз SQLite - nil
+}
+
+// Соединение с базой данных postgres по настройкам cfg. Возвращает ошибку,
+// если база недоступна. Схема создается миграциями из каталога migrations.
+func NewUserDatabase(ctx context.Context, cfg config.Postgres) (*UserDatabase, error) {
+	db, err := postgres.Open(ctx, cfg, gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+
+	database := &UserDatabase{Conn: db, Outbox: outbox.NewOutbox(db, outboxTable)}
+
+	// Миграции применяются отдельно, см. App.Migrate
+	if database.Migrations, err = migrate.New(db, "user", MigrationFiles()); err != nil {
+		_ = database.CloseUserDB()
+
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	log.Println("Successfully connected to database")
+
+	return database, nil
+}
+
+// Создает хранилище пользователей поверх SQLite, используется в тестах.
+func NewSQLiteUserDatabase(dsn string) (*UserDatabase, error) {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// Для ":memory:" каждое соединение получает свою базу, поэтому пул ограничен одним соединением
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve *sql.DB: %w", err)
+	}
+
+	sqlDB.SetMaxOpenConns(1)
+
+	database := &UserDatabase{Conn: db, Outbox: outbox.NewOutbox(db, outboxTable)}
+	if err = database.MigrateUserModels(); err != nil {
+		return nil, fmt.Errorf("failed to migrate models: %w", err)
+	}
+
+	return database, nil
+}
+
+// CloseUserDB закрывает базу данных.
+func (db *UserDatabase) CloseUserDB() error {
+	log.Println("Closing database connection...")
+	sqlDB, err := db.Conn.DB()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve *sql.DB: %w", err)
+	}
+	return sqlDB.Close()
+}
+
+// MigrateUserModels создает схему через AutoMigrate, используется для баз SQLite
+// в тестах. Схема postgres управляется миграциями.
+func (db *UserDatabase) MigrateUserModels() error {
+	if err := db.Conn.AutoMigrate(&model.User{}); err != nil {
+		return err
+	}
+
+	return db.Outbox.Migrate()
+}
+
+// Сохраняет нового пользователя, уникальность email обеспечивается индексом в базе.
+func (db *UserDatabase) CreateUser(user *model.User, messages ...model.OutboxMessage) error {
+	err := db.Conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return db.Outbox.Enqueue(tx, messages...)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrEmailTaken
+		}
+
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// Возвращает пользователя по id.
+func (db *UserDatabase) GetUserByID(id string) (*model.User, error) {
+	var user model.User
+	if err := db.Conn.Where("id = ?", id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// Возвращает пользователя по email.
+func (db *UserDatabase) GetUserByEmail(email string) (*model.User, error) {
+	var user model.User
+	if err := db.Conn.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// Сохраняет изменения существующего пользователя.
+func (db *UserDatabase) UpdateUser(user *model.User, messages ...model.OutboxMessage) error {
+	return db.Conn.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"name":          user.Name,
+			"email":         user.Email,
+			"password_hash": user.PasswordHash,
+		})
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrDuplicatedKey) {
+				return ErrEmailTaken
+			}
+
+			return fmt.Errorf("failed to update user: %w", res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		return db.Outbox.Enqueue(tx, messages...)
+	})
+}
+
+// Изменяет корзину пользователя в транзакции с блокировкой строки,
+// чтобы параллельные изменения корзины не терялись.
+func (db *UserDatabase) UpdateCart(id string, modify CartModifier) (*model.User, error) {
+	var user model.User
+
+	err := db.Conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		cart, messages, err := modify(user.Cart)
+		if err != nil {
+			return err
+		}
+
+		user.Cart = cart
+
+		if err := tx.Model(&user).Select("cart").Updates(&user).Error; err != nil {
+			return fmt.Errorf("failed to update cart: %w", err)
+		}
+
+		return db.Outbox.Enqueue(tx, messages...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,36 @@
+package db_test
+
+import (
+	"testing"
+
+	"Go-internship-Manifure/internal/db/user_db"
+	"Go-internship-Manifure/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepositoryUniqueEmail(t *testing.T) {
+	database, err := db.NewSQLiteUserDatabase(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, database.CreateUser(&model.User{ID: "1", Name: "John", Email: "john@example.com", PasswordHash: "1"}))
+
+	err = database.CreateUser(&model.User{ID: "2", Name: "Jane", Email: "john@example.com", PasswordHash: "2"})
+	require.ErrorIs(t, err, db.ErrEmailTaken)
+
+	require.NoError(t, database.CreateUser(&model.User{ID: "3", Name: "Jane", Email: "jane@example.com", PasswordHash: "3"}))
+
+	// Смена email на уже занятый также запрещена
+	err = database.UpdateUser(&model.User{ID: "3", Name: "Jane", Email: "john@example.com", PasswordHash: "3"})
+	require.ErrorIs(t, err, db.ErrEmailTaken)
+}
+
+func TestUserRepositoryNotFound(t *testing.T) {
+	database, err := db.NewSQLiteUserDatabase(":memory:")
+	require.NoError(t, err)
+
+	_, err = database.GetUserByID("missing")
+	require.ErrorIs(t, err, db.ErrUserNotFound)
+
+	err = database.UpdateUser(&model.User{ID: "missing", Name: "John", Email: "john@example.com"})
+	require.ErrorIs(t, err, db.ErrUserNotFound)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 
+	ledger "Go-internship-Manifure/internal/db/ledger_db"
+	k "Go-internship-Manifure/internal/kafka"
 	"Go-internship-Manifure/internal/model"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/go-playground/validator/v10"
@@ -13,27 +15,65 @@ import (
 type Handler struct {
 	DB       *gorm.DB
 	Validate *validator.Validate
+	Ledger   *ledger.Ledger // Журнал обработанных событий, без него событие применяется при каждой доставке
+
+	ProductTopic string // Топик событий продуктов, tombstone из других топиков пропускаются
 }
 
 // Создание нового обработчика аналитики.
-func NewAnalyticsHandler(db *gorm.DB) *Handler {
+func NewAnalyticsHandler(db *gorm.DB, events *ledger.Ledger) *Handler {
 	return &Handler{
 		DB:       db,
 		Validate: validator.New(),
+		Ledger:   events,
+
+		ProductTopic: "product-updates",
 	}
 }
 
 // Обработчик сообщений аналитики.
 func (h *Handler) HandleMessage(message []byte, topic kafka.TopicPartition, _ int) error {
-	switch *topic.Topic {
-	case "product-updates":
-		log.Printf("Message %s send to %s topic", message, *topic.Topic)
-		return h.HandleProductUpdate(message)
-	case "user-updates":
-		log.Printf("Message %s send to %s topic", message, *topic.Topic)
-		return h.HandleUserUpdate(message)
+	log.Printf("Message %s send to %s topic", message, *topic.Topic)
+
+	event, err := model.ParseEvent(message)
+	if err != nil {
+		log.Printf("Error parsing event: %v", err)
+
+		return k.Permanent(err)
+	}
+
+	if h.Ledger == nil {
+		return h.dispatch(event)
+	}
+
+	// Статистика обновляется в одной транзакции с записью в журнал,
+	// повторная доставка того же события пропускается
+	return h.Ledger.Apply(event, func(tx *gorm.DB) error {
+		return h.withDB(tx).dispatch(event)
+	})
+}
+
+// Копия обработчика, работающая в транзакции tx.
+func (h *Handler) withDB(tx *gorm.DB) *Handler {
+	c := *h
+	c.DB = tx
+
+	return &c
+}
+
+// Обработчик выбирается по типу события.
+func (h *Handler) dispatch(event *model.Event) error {
+	switch event.Type {
+	case model.ProductCreated, model.ProductUpdated:
+		return h.HandleProductUpdate(event.Payload)
+	case model.ProductDeleted:
+		return h.HandleProductDelete(event.Payload)
+	case model.UserRegistered, model.UserUpdated:
+		return h.HandleUserUpdate(event.Payload)
+	case model.CartItemAdded, model.CartItemRemoved:
+		return h.HandleCartUpdate(event.Payload)
 	default:
-		log.Printf("Unknown topic: %s", *topic.Topic)
+		log.Printf("Unknown event type: %s", event.Type)
 
 		return nil
 	}
@@ -47,18 +87,19 @@ func (h *Handler) HandleProductUpdate(message []byte) error {
 	if err := json.Unmarshal(message, &product); err != nil {
 		log.Printf("Error unmarshalling product update: %v", err)
 
-		return err
+		return k.Permanent(err)
 	}
 
 	// Валидация данных
 	if err := h.Validate.Struct(product); err != nil {
 		log.Printf("Error validating product update: %v", err)
 
-		return err
+		return k.Permanent(err)
 	}
 
 	// Обновление статистики в базе данных
-	err := h.DB.Model(&model.ProductStatistics{}).Where("product_id = ?", product.ID).FirstOrCreate(&model.ProductStatistics{ProductID: product.ID}).Update("update_count", gorm.Expr("update_count + ?", 1)).Error
+	// Unscoped, чтобы запоздавшие изменения удаленного продукта не создавали дубликат
+	err := h.DB.Unscoped().Model(&model.ProductStatistics{}).Where("product_id = ?", product.ID).FirstOrCreate(&model.ProductStatistics{ProductID: product.ID}).Update("update_count", gorm.Expr("update_count + ?", 1)).Error
 	if err != nil {
 		log.Printf("Error updating product statistics: %v", err)
 	}
@@ -66,6 +107,46 @@ func (h *Handler) HandleProductUpdate(message []byte) error {
 	return err
 }
 
+// Обработчик удаления продукта.
+func (h *Handler) HandleProductDelete(message []byte) error {
+	var product model.ProductUpdateAnalytics
+
+	// Десериализация сообщения
+	if err := json.Unmarshal(message, &product); err != nil {
+		log.Printf("Error unmarshalling product delete: %v", err)
+
+		return k.Permanent(err)
+	}
+
+	// Валидация данных
+	if err := h.Validate.Struct(product); err != nil {
+		log.Printf("Error validating product delete: %v", err)
+
+		return k.Permanent(err)
+	}
+
+	return h.deleteProductStatistics(product.ID)
+}
+
+// Обработчик tombstone из топика продуктов, ключ сообщения - id продукта.
+func (h *Handler) HandleTombstone(key []byte, topic kafka.TopicPartition) error {
+	if *topic.Topic != h.ProductTopic {
+		return nil
+	}
+
+	return h.deleteProductStatistics(string(key))
+}
+
+// Мягкое удаление статистики продукта.
+func (h *Handler) deleteProductStatistics(productID string) error {
+	err := h.DB.Where("product_id = ?", productID).Delete(&model.ProductStatistics{}).Error
+	if err != nil {
+		log.Printf("Error deleting product statistics: %v", err)
+	}
+
+	return err
+}
+
 // Обработчик данных пользователя.
 func (h *Handler) HandleUserUpdate(message []byte) error {
 	var user model.UserUpdateAnalytics
@@ -74,21 +155,46 @@ func (h *Handler) HandleUserUpdate(message []byte) error {
 	if err := json.Unmarshal(message, &user); err != nil {
 		log.Printf("Error unmarshalling user update: %v", err)
 
-		return err
+		return k.Permanent(err)
 	}
 
 	// Валидация данных
 	if err := h.Validate.Struct(user); err != nil {
 		log.Printf("Error validating user update: %v", err)
 
-		return err
+		return k.Permanent(err)
 	}
 
-	// Обновление статистики в базе данных
-	err := h.DB.Model(&model.UserStatistics{}).Where("user_id = ?", user.ID).FirstOrCreate(&model.UserStatistics{UserID: user.ID}).Update("activity_count", gorm.Expr("activity_count + ?", 1)).Error
+	return h.increaseUserActivity(user.ID)
+}
+
+// Обновление статистики активности пользователя в базе данных.
+func (h *Handler) increaseUserActivity(userID string) error {
+	err := h.DB.Model(&model.UserStatistics{}).Where("user_id = ?", userID).FirstOrCreate(&model.UserStatistics{UserID: userID}).Update("activity_count", gorm.Expr("activity_count + ?", 1)).Error
 	if err != nil {
 		log.Printf("Error updating user activity count: %v", err)
 	}
 
 	return err
 }
+
+// Обработчик изменений корзины, учитывается как активность пользователя.
+func (h *Handler) HandleCartUpdate(message []byte) error {
+	var cart model.CartUpdateAnalytics
+
+	// Десериализация сообщения
+	if err := json.Unmarshal(message, &cart); err != nil {
+		log.Printf("Error unmarshalling cart update: %v", err)
+
+		return k.Permanent(err)
+	}
+
+	// Валидация данных
+	if err := h.Validate.Struct(cart); err != nil {
+		log.Printf("Error validating cart update: %v", err)
+
+		return k.Permanent(err)
+	}
+
+	return h.increaseUserActivity(cart.UserID)
+}
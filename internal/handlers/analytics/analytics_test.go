@@ -5,8 +5,11 @@ import (
 	"log"
 	"testing"
 
+	ledger "Go-internship-Manifure/internal/db/ledger_db"
 	"Go-internship-Manifure/internal/handlers/analytics"
+	k "Go-internship-Manifure/internal/kafka"
 	"Go-internship-Manifure/internal/model"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -19,16 +22,27 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
+	// Одно соединение, чтобы транзакции работали с той же базой в памяти
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
 	// Автоматически мигрировать таблицы
 	err = db.AutoMigrate(&model.ProductStatistics{}, &model.UserStatistics{})
 	require.NoError(t, err)
+	require.NoError(t, testLedger(db).Migrate())
 
 	return db
 }
 
+// Журнал обработанных событий в тестовой базе.
+func testLedger(db *gorm.DB) *ledger.Ledger {
+	return ledger.NewLedger(db, "processed_events")
+}
+
 func TestHandleProductUpdate(t *testing.T) {
 	db := setupTestDB(t)
-	handler := analytics.NewAnalyticsHandler(db)
+	handler := analytics.NewAnalyticsHandler(db, nil)
 
 	// Генерируем валидный UUID
 	productID := uuid.New().String()
@@ -50,7 +64,7 @@ func TestHandleProductUpdate(t *testing.T) {
 
 func TestHandleUserUpdate(t *testing.T) {
 	db := setupTestDB(t)
-	handler := analytics.NewAnalyticsHandler(db)
+	handler := analytics.NewAnalyticsHandler(db, nil)
 
 	// Генерируем валидный UUID
 	userID := uuid.New().String()
@@ -69,3 +83,107 @@ func TestHandleUserUpdate(t *testing.T) {
 	require.Equal(t, 1, stats.ActivityCount)
 	log.Printf("%v", stats)
 }
+
+func TestHandleMessageDispatchesByType(t *testing.T) {
+	db := setupTestDB(t)
+	handler := analytics.NewAnalyticsHandler(db, testLedger(db))
+	topic := "user-updates"
+
+	userID := uuid.New().String()
+
+	payloads := map[string]any{
+		model.UserRegistered:  map[string]string{"id": userID},
+		model.CartItemAdded:   model.CartEvent{UserID: userID, ProductID: uuid.New().String(), Quantity: 1},
+		model.CartItemRemoved: model.CartEvent{UserID: userID, ProductID: uuid.New().String(), Quantity: 1},
+		"user.unknown":        map[string]string{"id": userID},
+	}
+
+	for eventType, payload := range payloads {
+		event, err := model.NewEvent(eventType, "user-service", payload)
+		require.NoError(t, err)
+
+		message, err := json.Marshal(event)
+		require.NoError(t, err)
+
+		err = handler.HandleMessage(message, kafka.TopicPartition{Topic: &topic}, 1)
+		require.NoError(t, err)
+	}
+
+	// Неизвестный тип события пропускается
+	var stats model.UserStatistics
+	err := db.Where("user_id = ?", userID).First(&stats).Error
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.ActivityCount)
+}
+
+func TestHandleProductDelete(t *testing.T) {
+	db := setupTestDB(t)
+	handler := analytics.NewAnalyticsHandler(db, testLedger(db))
+	topic := "product-updates"
+
+	productID := uuid.New().String()
+
+	message, err := json.Marshal(map[string]string{"id": productID})
+	require.NoError(t, err)
+
+	require.NoError(t, handler.HandleProductUpdate(message))
+
+	// Tombstone из другого топика пропускается
+	other := "catalog"
+	require.NoError(t, handler.HandleTombstone([]byte(productID), kafka.TopicPartition{Topic: &other}))
+	require.NoError(t, db.Where("product_id = ?", productID).First(&model.ProductStatistics{}).Error)
+
+	event, err := model.NewEvent(model.ProductDeleted, "product-service", model.ProductDeletedEvent{ID: productID})
+	require.NoError(t, err)
+
+	deleted, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	err = handler.HandleMessage(deleted, kafka.TopicPartition{Topic: &topic}, 1)
+	require.NoError(t, err)
+
+	// Статистика скрыта, но не удалена физически
+	err = db.Where("product_id = ?", productID).First(&model.ProductStatistics{}).Error
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// Запоздавшее изменение не восстанавливает удаленный продукт
+	require.NoError(t, handler.HandleProductUpdate(message))
+	require.NoError(t, handler.HandleTombstone([]byte(productID), kafka.TopicPartition{Topic: &topic}))
+
+	var stats model.ProductStatistics
+	err = db.Unscoped().Where("product_id = ?", productID).First(&stats).Error
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.UpdateCount)
+	require.True(t, stats.DeletedAt.Valid)
+}
+
+func TestHandleProductUpdateInvalidMessageIsPermanent(t *testing.T) {
+	handler := analytics.NewAnalyticsHandler(setupTestDB(t), nil)
+
+	// Некорректный JSON и невалидный id не исправятся при повторе
+	require.True(t, k.IsPermanent(handler.HandleProductUpdate([]byte("not json"))))
+	require.True(t, k.IsPermanent(handler.HandleProductUpdate([]byte(`{"id":"not-uuid"}`))))
+}
+
+func TestHandleMessageSkipsRedeliveredEvent(t *testing.T) {
+	db := setupTestDB(t)
+	handler := analytics.NewAnalyticsHandler(db, testLedger(db))
+	topic := "product-updates"
+
+	productID := uuid.New().String()
+
+	event, err := model.NewEvent(model.ProductUpdated, "product-service", map[string]string{"id": productID})
+	require.NoError(t, err)
+
+	message, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	// Повторная доставка того же события не меняет статистику
+	for range 3 {
+		require.NoError(t, handler.HandleMessage(message, kafka.TopicPartition{Topic: &topic}, 1))
+	}
+
+	var stats model.ProductStatistics
+	require.NoError(t, db.Where("product_id = ?", productID).First(&stats).Error)
+	require.Equal(t, 1, stats.UpdateCount)
+}
@@ -21,9 +21,24 @@ func NewMonitoredHandler(handler *Handler) *MonitoredHandler {
 func (mh *MonitoredHandler) HandleMessage(message []byte, topic kafka.TopicPartition, cn int) error {
 	start := time.Now()
 	err := mh.handler.HandleMessage(message, topic, cn)
-	duration := time.Since(start).Seconds()
 
-	topicName := *topic.Topic
+	mh.observe(*topic.Topic, start, err)
+
+	return err
+}
+
+// Обрабатывает tombstone с мониторингом.
+func (mh *MonitoredHandler) HandleTombstone(key []byte, topic kafka.TopicPartition) error {
+	start := time.Now()
+	err := mh.handler.HandleTombstone(key, topic)
+
+	mh.observe(*topic.Topic, start, err)
+
+	return err
+}
+
+func (mh *MonitoredHandler) observe(topicName string, start time.Time, err error) {
+	duration := time.Since(start).Seconds()
 	status := "success"
 
 	if err != nil {
@@ -35,6 +50,4 @@ func (mh *MonitoredHandler) HandleMessage(message []byte, topic kafka.TopicParti
 	// Обновление метрик
 	monitoring.KafkaMessagesConsumedTotal.WithLabelValues(topicName, status).Inc()
 	monitoring.KafkaMessageProcessingDuration.WithLabelValues(topicName).Observe(duration)
-
-	return err
 }
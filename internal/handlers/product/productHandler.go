@@ -2,25 +2,32 @@ package product
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
-	"Go-internship-Manifure/internal/kafka"
+	"Go-internship-Manifure/internal/auth"
+	"Go-internship-Manifure/internal/db/product_db"
 	"Go-internship-Manifure/internal/model"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// Имя сервиса в поле producer событий.
+const eventProducer = "product-service"
+
+// События отправляются в kafka через outbox хранилища продуктов.
 type Handler struct {
-	Products      map[string]model.Product
-	KafkaProducer kafka.ProducerInterface
+	Products db.ProductRepository
 }
 
 // Создание нового обработчика продуктов.
-func NewProductHandler(kafkaProducer kafka.ProducerInterface) *Handler {
+func NewProductHandler(products db.ProductRepository) *Handler {
 	return &Handler{
-		Products:      make(map[string]model.Product),
-		KafkaProducer: kafkaProducer,
+		Products: products,
 	}
 }
 
@@ -41,44 +48,165 @@ func (ph *Handler) AddProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	product.ID = uuid.New().String()
-	ph.Products[product.ID] = product
 
-	message, err := json.Marshal(product)
+	message, err := newOutboxMessage(model.ProductCreated, product.ID, newProductEvent(r, &product))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, "Failed to create event", http.StatusInternalServerError)
+
+		return
+	}
+
+	if err := ph.Products.CreateProduct(&product, message); err != nil {
+		writeRepositoryError(w, err)
 
 		return
 	}
 
-	err = ph.KafkaProducer.Produce(string(message))
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(product)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
 		return
 	}
+}
 
-	w.WriteHeader(http.StatusCreated)
+// Ответ со страницей списка продуктов.
+type listResponse struct {
+	Items      []model.Product `json:"items"`
+	NextCursor string          `json:"next_cursor"`
+}
+
+// Получение продукта по id.
+func (ph *Handler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	product, err := ph.Products.GetProductByID(id)
+	if err != nil {
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 
 	err = json.NewEncoder(w).Encode(product)
+	if err != nil {
+		http.Error(w, "Failed to encode product data", http.StatusInternalServerError)
+
+		return
+	}
+}
+
+// Получение списка продуктов с фильтрацией, сортировкой и постраничной выдачей.
+func (ph *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseListFilter(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
 		return
 	}
+
+	products, nextCursor, err := ph.Products.ListProducts(filter)
+	if err != nil {
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	if products == nil {
+		products = []model.Product{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(listResponse{Items: products, NextCursor: nextCursor})
+	if err != nil {
+		http.Error(w, "Failed to encode products", http.StatusInternalServerError)
+
+		return
+	}
+}
+
+// Разбор параметров запроса списка: q, min_price, max_price, sort (price, -price, views, -views), limit, cursor.
+func parseListFilter(r *http.Request) (db.ListFilter, error) {
+	query := r.URL.Query()
+	filter := db.ListFilter{
+		Query:  query.Get("q"),
+		Cursor: query.Get("cursor"),
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		filter.Desc = strings.HasPrefix(sort, "-")
+		filter.SortBy = strings.TrimPrefix(sort, "-")
+
+		if filter.SortBy != db.SortByPrice && filter.SortBy != db.SortByViews {
+			return filter, fmt.Errorf("unsupported sort: %s", sort)
+		}
+	}
+
+	var err error
+
+	if limit := query.Get("limit"); limit != "" {
+		parsedLimit, err := strconv.Atoi(limit)
+		if err != nil || parsedLimit <= 0 {
+			return filter, fmt.Errorf("invalid limit: %s", limit)
+		}
+
+		filter.Limit = parsedLimit
+	}
+
+	if filter.MinPrice, err = parsePrice(query.Get("min_price")); err != nil {
+		return filter, err
+	}
+
+	if filter.MaxPrice, err = parsePrice(query.Get("max_price")); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// Разбор необязательной границы цены.
+func parsePrice(value string) (*float32, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	price, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price: %s", value)
+	}
+
+	p := float32(price)
+
+	return &p, nil
 }
 
 // Удаление продукта.
 func (ph *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	if _, ok := ph.Products[id]; !ok {
-		http.Error(w, "Product not found", http.StatusNotFound)
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	message, err := newOutboxMessage(model.ProductDeleted, id, model.ProductDeletedEvent{ID: id, DeletedBy: userID})
+	if err != nil {
+		http.Error(w, "Failed to create event", http.StatusInternalServerError)
 
 		return
 	}
 
-	delete(ph.Products, id)
-	log.Printf("Product %v deleted", id)
+	// Tombstone удаляет продукт из компактированного топика
+	if err := ph.Products.DeleteProduct(id, message, model.NewOutboxTombstone(id)); err != nil {
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	log.Printf("Product %v deleted by user %s", id, userID)
+
+	w.WriteHeader(http.StatusOK)
 }
 
 // Обновление продукта.
@@ -93,9 +221,9 @@ func (ph *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, ok := ph.Products[id]
-	if !ok {
-		http.Error(w, "Product not found", http.StatusNotFound)
+	product, err := ph.Products.GetProductByID(id)
+	if err != nil {
+		writeRepositoryError(w, err)
 
 		return
 	}
@@ -105,18 +233,16 @@ func (ph *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	product.Price = UpdatedProduct.Price
-	ph.Products[id] = product
 
-	message, err := json.Marshal(product)
+	message, err := newOutboxMessage(model.ProductUpdated, product.ID, newProductEvent(r, product))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, "Failed to create event", http.StatusInternalServerError)
 
 		return
 	}
 
-	err = ph.KafkaProducer.Produce(string(message))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := ph.Products.UpdateProduct(product, message); err != nil {
+		writeRepositoryError(w, err)
 
 		return
 	}
@@ -130,3 +256,37 @@ func (ph *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// Формирует сообщение outbox с событием сервиса продуктов, ключ - id продукта.
+func newOutboxMessage(eventType, key string, payload any) (model.OutboxMessage, error) {
+	event, err := model.NewEvent(eventType, eventProducer, payload)
+	if err != nil {
+		return model.OutboxMessage{}, err
+	}
+
+	return model.NewOutboxMessage(key, event)
+}
+
+// Формирует payload события с id пользователя, выполнившего изменение.
+func newProductEvent(r *http.Request, product *model.Product) model.ProductEvent {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	return model.ProductEvent{Product: *product, UpdatedBy: userID}
+}
+
+// Преобразует ошибку хранилища в HTTP ответ.
+func writeRepositoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrProductNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+
+		return
+	case errors.Is(err, db.ErrInvalidCursor):
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+
+		return
+	}
+
+	log.Printf("Product repository error: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
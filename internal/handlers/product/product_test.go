@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
 
+	"Go-internship-Manifure/internal/auth"
+	"Go-internship-Manifure/internal/db/product_db"
 	"Go-internship-Manifure/internal/handlers/product"
 	"Go-internship-Manifure/internal/kafka"
 	"Go-internship-Manifure/internal/model"
@@ -14,8 +18,8 @@ import (
 )
 
 func TestAddProduct(t *testing.T) {
-	mockProducer := &kafka.MockProducer{}
-	handler := product.NewProductHandler(mockProducer)
+	repository := db.NewMemoryRepository()
+	handler := product.NewProductHandler(repository)
 
 	// Данные нового продукта
 	productData := model.Product{Name: "Test Product", Price: 100.50}
@@ -43,7 +47,7 @@ func TestAddProduct(t *testing.T) {
 	}
 
 	// Проверка, что продукт добавлен в обработчик
-	if _, exists := handler.Products[createdProduct.ID]; !exists {
+	if _, err := handler.Products.GetProductByID(createdProduct.ID); err != nil {
 		t.Fatalf("product not saved in handler: %+v", createdProduct)
 	}
 
@@ -54,12 +58,14 @@ func TestAddProduct(t *testing.T) {
 }
 
 func TestDeleteProduct(t *testing.T) {
-	mockProducer := &kafka.MockProducer{}
-	handler := product.NewProductHandler(mockProducer)
+	repository := db.NewMemoryRepository()
+	handler := product.NewProductHandler(repository)
 
 	// Создание продукта для теста
 	productID := "test-product-id"
-	handler.Products[productID] = model.Product{ID: productID, Name: "Test Product", Price: 100.50, Views: 100}
+	if err := handler.Products.CreateProduct(&model.Product{ID: productID, Name: "Test Product", Price: 100.50, Views: 100}); err != nil {
+		t.Fatalf("failed to create product: %v", err)
+	}
 
 	req := httptest.NewRequest(http.MethodDelete, "/products/"+productID, nil)
 	responseRecorder := httptest.NewRecorder()
@@ -73,18 +79,32 @@ func TestDeleteProduct(t *testing.T) {
 	}
 
 	// Проверка, что продукт удален из обработчика
-	if _, exists := handler.Products[productID]; exists {
-		t.Fatalf("product was not deleted: %+v", handler.Products[productID])
+	if deleted, err := handler.Products.GetProductByID(productID); err == nil {
+		t.Fatalf("product was not deleted: %+v", deleted)
+	}
+
+	producer := relayOutbox(t, repository.Outbox)
+
+	// Событие удаления и tombstone с id продукта в качестве ключа
+	if len(producer.Values()) != 1 || len(producer.Tombstones()) != 1 || producer.Tombstones()[0] != productID {
+		t.Fatalf("unexpected kafka messages: %v, tombstones: %v", producer.Values(), producer.Tombstones())
+	}
+
+	event, err := model.ParseEvent([]byte(producer.Values()[0]))
+	if err != nil || event.Type != model.ProductDeleted {
+		t.Fatalf("unexpected kafka event: %+v, %v", event, err)
 	}
 }
 
 func TestUpdateProduct(t *testing.T) {
-	mockProducer := &kafka.MockProducer{}
-	handler := product.NewProductHandler(mockProducer)
+	repository := db.NewMemoryRepository()
+	handler := product.NewProductHandler(repository)
 
 	// Создание продукта для теста
 	productID := "test-product-id"
-	handler.Products[productID] = model.Product{ID: productID, Name: "Old Product", Price: 100.50, Views: 100}
+	if err := handler.Products.CreateProduct(&model.Product{ID: productID, Name: "Old Product", Price: 100.50, Views: 100}); err != nil {
+		t.Fatalf("failed to create product: %v", err)
+	}
 
 	updatedProductData := model.Product{Name: "Updated Product", Price: 150.75, Views: 150}
 
@@ -107,8 +127,184 @@ func TestUpdateProduct(t *testing.T) {
 	}
 
 	// Проверка, что продукт обновлен
-	updatedProduct := handler.Products[productID]
+	updatedProduct, err := handler.Products.GetProductByID(productID)
+	if err != nil {
+		t.Fatalf("failed to get product: %v", err)
+	}
+
 	if updatedProduct.Name != updatedProductData.Name || updatedProduct.Price != updatedProductData.Price {
 		t.Fatalf("product not updated correctly: got %+v, want %+v", updatedProduct, updatedProductData)
 	}
 }
+
+func TestAddProductConcurrent(t *testing.T) {
+	repository := db.NewMemoryRepository()
+	handler := product.NewProductHandler(repository)
+
+	body, err := json.Marshal(model.Product{Name: "Test Product", Price: 10})
+	if err != nil {
+		t.Fatalf("Failed to marshal product data: %s", err)
+	}
+
+	var wg sync.WaitGroup
+
+	for range 20 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader(body))
+			handler.AddProduct(httptest.NewRecorder(), req)
+		}()
+	}
+
+	wg.Wait()
+
+	producer := relayOutbox(t, repository.Outbox)
+
+	if len(producer.Values()) != 20 {
+		t.Fatalf("expected 20 messages, got %d", len(producer.Values()))
+	}
+}
+
+func TestGetProduct(t *testing.T) {
+	handler := product.NewProductHandler(db.NewMemoryRepository())
+
+	productID := "test-product-id"
+	if err := handler.Products.CreateProduct(&model.Product{ID: productID, Name: "Test Product", Price: 100.50}); err != nil {
+		t.Fatalf("failed to create product: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/{id}", handler.GetProduct).Methods(http.MethodGet)
+
+	responseRecorder := httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/products/"+productID, nil))
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %v, want %v", responseRecorder.Code, http.StatusOK)
+	}
+
+	var fetchedProduct model.Product
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&fetchedProduct); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+
+	if fetchedProduct.ID != productID || fetchedProduct.Name != "Test Product" {
+		t.Fatalf("unexpected product data: %+v", fetchedProduct)
+	}
+
+	responseRecorder = httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/products/missing", nil))
+
+	if responseRecorder.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code: got %v, want %v", responseRecorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestListProducts(t *testing.T) {
+	handler := product.NewProductHandler(db.NewMemoryRepository())
+
+	for i, price := range []float32{30, 10, 20} {
+		p := model.Product{ID: strconv.Itoa(i), Name: "Product " + strconv.Itoa(i), Price: price}
+		if err := handler.Products.CreateProduct(&p); err != nil {
+			t.Fatalf("failed to create product: %v", err)
+		}
+	}
+
+	type page struct {
+		Items      []model.Product `json:"items"`
+		NextCursor string          `json:"next_cursor"`
+	}
+
+	fetch := func(url string) page {
+		responseRecorder := httptest.NewRecorder()
+		handler.ListProducts(responseRecorder, httptest.NewRequest(http.MethodGet, url, nil))
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: got %v, want %v", responseRecorder.Code, http.StatusOK)
+		}
+
+		var result page
+		if err := json.NewDecoder(responseRecorder.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode response body: %v", err)
+		}
+
+		return result
+	}
+
+	first := fetch("/products?sort=-price&limit=2")
+	if len(first.Items) != 2 || first.Items[0].Price != 30 || first.Items[1].Price != 20 || first.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	second := fetch("/products?sort=-price&limit=2&cursor=" + first.NextCursor)
+	if len(second.Items) != 1 || second.Items[0].Price != 10 || second.NextCursor != "" {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	handler.ListProducts(responseRecorder, httptest.NewRequest(http.MethodGet, "/products?sort=name", nil))
+
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code: got %v, want %v", responseRecorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAddProductRecordsActor(t *testing.T) {
+	repository := db.NewMemoryRepository()
+	handler := product.NewProductHandler(repository)
+
+	body, err := json.Marshal(model.Product{Name: "Test Product", Price: 10})
+	if err != nil {
+		t.Fatalf("Failed to marshal product data: %s", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader(body))
+	req = req.WithContext(auth.WithClaims(req.Context(), &auth.Claims{UserID: "merchant-1", Role: auth.RoleMerchant}))
+
+	responseRecorder := httptest.NewRecorder()
+	handler.AddProduct(responseRecorder, req)
+
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code: got %v, want %v", responseRecorder.Code, http.StatusCreated)
+	}
+
+	producer := relayOutbox(t, repository.Outbox)
+
+	event, err := model.ParseEvent([]byte(producer.Values()[0]))
+	if err != nil {
+		t.Fatalf("failed to decode kafka message: %v", err)
+	}
+
+	if event.Type != model.ProductCreated || event.Producer != "product-service" {
+		t.Fatalf("unexpected kafka event: %+v", event)
+	}
+
+	var payload model.ProductEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		t.Fatalf("failed to decode event payload: %v", err)
+	}
+
+	if payload.UpdatedBy != "merchant-1" || payload.Name != "Test Product" {
+		t.Fatalf("unexpected kafka message: %+v", payload)
+	}
+	// Ключ сообщения - id продукта, тип события продублирован в заголовке
+	message := producer.Messages[0]
+	if message.Key != payload.ID || message.Headers["event_type"] != model.ProductCreated {
+		t.Fatalf("unexpected kafka key or headers: %q, %v", message.Key, message.Headers)
+	}
+}
+
+// Отправляет накопленные в outbox сообщения в продюсер в памяти.
+func relayOutbox(t *testing.T, store kafka.OutboxStore) *kafka.MemoryProducer {
+	t.Helper()
+
+	producer := kafka.NewMemoryProducer(3)
+	if _, err := kafka.NewOutboxRelay("test", store, producer).RelayOnce(); err != nil {
+		t.Fatalf("failed to relay outbox: %v", err)
+	}
+
+	return producer
+}
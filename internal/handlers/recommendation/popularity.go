@@ -0,0 +1,140 @@
+package recommendation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"Go-internship-Manifure/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Единственная строка таблицы эпохи.
+const epochID = 1
+
+// Веса событий в популярности продукта.
+type Weights struct {
+	CartAdd       float64
+	ProductUpdate float64
+}
+
+// Популярность, затухающая вдвое за HalfLife, Score хранится в масштабе общей эпохи.
+type Scoring struct {
+	HalfLife time.Duration
+	Weights  Weights
+}
+
+// Затухание вдвое за неделю, добавление в корзину весит больше изменения продукта.
+func DefaultScoring() *Scoring {
+	return &Scoring{
+		HalfLife: 7 * 24 * time.Hour,
+		Weights: Weights{
+			CartAdd:       3,
+			ProductUpdate: 1,
+		},
+	}
+}
+
+// Вес события, неизвестные типы не влияют на популярность.
+func (s *Scoring) weight(eventType string) float64 {
+	switch eventType {
+	case model.CartItemAdded:
+		return s.Weights.CartAdd
+	case model.ProductCreated, model.ProductUpdated:
+		return s.Weights.ProductUpdate
+	default:
+		return 0
+	}
+}
+
+// Множитель, переводящий значение из масштаба момента from в масштаб to.
+func (s *Scoring) scale(from, to time.Time) float64 {
+	return math.Exp2(-to.Sub(from).Seconds() / s.HalfLife.Seconds())
+}
+
+// Вклад события в хранимый Score.
+func (s *Scoring) increment(eventType string, at, epoch time.Time) float64 {
+	return s.weight(eventType) / s.scale(epoch, at)
+}
+
+// Текущая популярность по хранимому значению.
+func (s *Scoring) Decay(score float64, epoch, now time.Time) float64 {
+	return score * s.scale(epoch, now)
+}
+
+// Переносит эпоху в now и пересчитывает хранимые значения. Эпоха блокируется
+// на время пересчета, а обработчики событий читают ее с разделяемой блокировкой
+// в своей транзакции, поэтому обновления не смешивают масштабы.
+func (s *Scoring) Rebase(db *gorm.DB, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		epoch, err := currentEpoch(tx, clause.Locking{Strength: "UPDATE"})
+		if err != nil {
+			return err
+		}
+
+		if !now.After(epoch) {
+			return nil
+		}
+
+		factor := s.scale(epoch, now)
+
+		err = tx.Model(&model.Recommendations{}).Where("score <> 0").
+			Update("score", gorm.Expr("score * ?", factor)).Error
+		if err != nil {
+			return fmt.Errorf("failed to rebase popularity scores: %w", err)
+		}
+
+		err = tx.Model(&model.PopularityEpoch{}).Where("id = ?", epochID).Update("epoch", now.UTC()).Error
+		if err != nil {
+			return fmt.Errorf("failed to update popularity epoch: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Периодически переносит эпоху до отмены контекста.
+func (s *Scoring) RunRebase(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Rebase(db.WithContext(ctx), time.Now()); err != nil {
+				log.Printf("Failed to rebase popularity scores: %v", err)
+			} else {
+				log.Println("Popularity scores rebased")
+			}
+		}
+	}
+}
+
+// Эпоха хранимых значений Score. Строку создает миграция, в тестовых базах
+// она создается при первой записи.
+func currentEpoch(db *gorm.DB, locking ...clause.Expression) (time.Time, error) {
+	var epoch model.PopularityEpoch
+
+	err := db.Clauses(locking...).Where("id = ?", epochID).Take(&epoch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		epoch = model.PopularityEpoch{ID: epochID, Epoch: time.Now().UTC()}
+
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&epoch).Error; err != nil {
+			return time.Time{}, fmt.Errorf("failed to create popularity epoch: %w", err)
+		}
+
+		err = db.Clauses(locking...).Where("id = ?", epochID).Take(&epoch).Error
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read popularity epoch: %w", err)
+	}
+
+	return epoch.Epoch, nil
+}
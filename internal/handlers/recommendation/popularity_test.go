@@ -0,0 +1,142 @@
+package recommendation_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/handlers/recommendation"
+	"Go-internship-Manifure/internal/model"
+	"Go-internship-Manifure/internal/redis"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Отправляет обработчику событие eventType, произошедшее в момент at.
+func handleEvent(t *testing.T, handler *recommendation.Handler, eventType string, payload any, at time.Time) {
+	t.Helper()
+
+	event, err := model.NewEvent(eventType, "test", payload)
+	require.NoError(t, err)
+	event.OccurredAt = at
+
+	message, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	topic := "product-updates"
+	require.NoError(t, handler.HandleMessage(message, kafka.TopicPartition{Topic: &topic}, 1))
+}
+
+func storedScore(t *testing.T, db *gorm.DB, id string) float64 {
+	t.Helper()
+
+	var product model.Recommendations
+	require.NoError(t, db.First(&product, "id = ?", id).Error)
+
+	return product.Score
+}
+
+func TestScoringDecay(t *testing.T) {
+	scoring := recommendation.DefaultScoring()
+	epoch := time.Now()
+
+	require.InDelta(t, 8, scoring.Decay(8, epoch, epoch), 1e-9)
+	require.InDelta(t, 4, scoring.Decay(8, epoch, epoch.Add(scoring.HalfLife)), 1e-9)
+	require.InDelta(t, 1, scoring.Decay(8, epoch, epoch.Add(3*scoring.HalfLife)), 1e-9)
+}
+
+func TestEventWeights(t *testing.T) {
+	db := setupTestDB(t)
+	handler := recommendation.NewRecommendationHandler(db, redis.NewCacheMock(), testLedger(db))
+	weights := handler.Scoring.Weights
+	now := time.Now()
+
+	handleEvent(t, handler, model.ProductUpdated, model.Product{ID: "updated", Name: "Updated"}, now)
+	handleEvent(t, handler, model.CartItemAdded, model.CartEvent{ProductID: "carted", UserID: "user", Quantity: 1}, now)
+
+	require.InDelta(t, weights.ProductUpdate, storedScore(t, db, "updated"), 0.01)
+	require.InDelta(t, weights.CartAdd, storedScore(t, db, "carted"), 0.01)
+
+	// Добавление в корзину трехнедельной давности весит меньше недавнего изменения продукта
+	handleEvent(t, handler, model.CartItemAdded, model.CartEvent{ProductID: "old", UserID: "user", Quantity: 1},
+		now.Add(-3*handler.Scoring.HalfLife))
+	require.InDelta(t, weights.CartAdd/8, storedScore(t, db, "old"), 0.01)
+
+	rec := httptest.NewRecorder()
+	recommendation.NewRecommendationAPIHandler(db, redis.NewCacheMock()).
+		GetRecommendations(rec, httptest.NewRequest(http.MethodGet, "/recommendations", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var recommendations []model.Recommendations
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &recommendations))
+
+	var ids []string
+	for _, r := range recommendations {
+		ids = append(ids, r.ID)
+	}
+
+	require.Equal(t, []string{"carted", "updated", "old"}, ids)
+}
+
+func TestRebaseKeepsDecayedScores(t *testing.T) {
+	db := setupTestDB(t)
+	handler := recommendation.NewRecommendationHandler(db, redis.NewCacheMock(), nil)
+	scoring := handler.Scoring
+	now := time.Now()
+
+	handleEvent(t, handler, model.CartItemAdded, model.CartEvent{ProductID: "product1", Quantity: 1}, now)
+	handleEvent(t, handler, model.ProductUpdated, model.Product{ID: "product2", Name: "Product"}, now)
+
+	before := storedScore(t, db, "product1")
+
+	// Через период полураспада хранимые значения уменьшаются вдвое,
+	// а текущая популярность не меняется
+	later := now.Add(scoring.HalfLife)
+	require.NoError(t, scoring.Rebase(db, later))
+
+	require.InDelta(t, before/2, storedScore(t, db, "product1"), 0.01)
+	require.InDelta(t, scoring.Decay(before, now, later), scoring.Decay(storedScore(t, db, "product1"), later, later), 0.01)
+	require.Greater(t, storedScore(t, db, "product1"), storedScore(t, db, "product2"))
+
+	// Новое событие учитывается в масштабе новой эпохи
+	handleEvent(t, handler, model.ProductUpdated, model.Product{ID: "product2", Name: "Product"}, later)
+	require.InDelta(t, scoring.Weights.ProductUpdate*1.5, storedScore(t, db, "product2"), 0.01)
+}
+
+// Рекомендации из базы, кэш пустой.
+func freshRecommendations(t *testing.T, db *gorm.DB) []model.Recommendations {
+	t.Helper()
+
+	rec := getRecommendations(t, recommendation.NewRecommendationAPIHandler(db, redis.NewCacheMock()))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var recommendations []model.Recommendations
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &recommendations))
+
+	return recommendations
+}
+
+func TestGetRecommendationsDecaysWithoutWritingEpoch(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&model.Recommendations{ID: "product1", Name: "Product", Score: 2}).Error)
+
+	recommendations := freshRecommendations(t, db)
+	require.Len(t, recommendations, 1)
+	require.InDelta(t, 2, recommendations[0].Score, 1e-9)
+
+	// Чтение списка не создает эпоху
+	var epochs int64
+	require.NoError(t, db.Model(&model.PopularityEpoch{}).Count(&epochs).Error)
+	require.Zero(t, epochs)
+
+	// Значение, хранимое в масштабе эпохи недельной давности, отдается с затуханием
+	halfLife := recommendation.DefaultScoring().HalfLife
+	require.NoError(t, db.Create(&model.PopularityEpoch{ID: 1, Epoch: time.Now().Add(-halfLife).UTC()}).Error)
+
+	recommendations = freshRecommendations(t, db)
+	require.Len(t, recommendations, 1)
+	require.InDelta(t, 1, recommendations[0].Score, 1e-3)
+}
@@ -9,24 +9,40 @@ import (
 	"time"
 
 	"Go-internship-Manifure/internal/model"
+	"Go-internship-Manifure/internal/monitoring"
 	"Go-internship-Manifure/internal/redis"
 	"gorm.io/gorm"
 )
 
+const (
+	// Префикс ключей кэша со списками рекомендаций.
+	cacheKeyPrefix = "recommendations:"
+
+	// Префикс последних полученных из базы списков. Они отдаются, если база
+	// недоступна, и не удаляются при сбросе кэша.
+	staleKeyPrefix = "recommendations-stale:"
+
+	cacheTTL = time.Minute
+	staleTTL = 24 * time.Hour
+)
+
 type APIHandler struct {
-	DB    *gorm.DB
-	Cache redis.CacheInterface
+	DB      *gorm.DB
+	Cache   redis.CacheInterface
+	Scoring *Scoring // Затухание популярности в ответах
 }
 
 // Инициализация нового API обработчика.
 func NewRecommendationAPIHandler(db *gorm.DB, cache redis.CacheInterface) *APIHandler {
 	return &APIHandler{
-		DB:    db,
-		Cache: cache,
+		DB:      db,
+		Cache:   cache,
+		Scoring: DefaultScoring(),
 	}
 }
 
-// Получение рекомендаций.
+// Получение рекомендаций. Если redis недоступен, список читается из базы,
+// если недоступна база - отдается последний сохраненный в redis список.
 func (api *APIHandler) GetRecommendations(w http.ResponseWriter, r *http.Request) {
 	limitParam := r.URL.Query().Get("limit")
 	limit := 10 // default value
@@ -38,36 +54,39 @@ func (api *APIHandler) GetRecommendations(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	cacheKey := fmt.Sprintf("recommendations:limit:%d", limit) // Ключ для кэша
+	cacheKey := fmt.Sprintf(cacheKeyPrefix+"limit:%d", limit) // Ключ для кэша
+	staleKey := fmt.Sprintf(staleKeyPrefix+"limit:%d", limit)
+
 	// Проверка наличия данных в кэше
 	cacheData, err := api.Cache.Get(cacheKey)
+	setDependencyStatus("redis", err)
+
 	if err != nil {
-		log.Printf("Error accessing Redis: %v\n", err)
-		http.Error(w, "Failed to access cache", http.StatusInternalServerError)
+		log.Printf("Error accessing Redis, reading recommendations from database: %v", err)
+	} else if cacheData != "" {
+		log.Printf("Cache found")
+		writeRecommendations(w, cacheData)
 
 		return
+	} else {
+		log.Println("Not found recommendations in cache")
 	}
 
-	if cacheData != "" {
-		log.Printf("Cache found")
-		w.Header().Set("Content-Type", "application/json")
+	cacheAvailable := err == nil
 
-		_, err := w.Write([]byte(cacheData))
-		if err != nil {
-			log.Printf("Error writing response: %v\n", err)
+	product, err := api.fetchRecommendations(limit)
+	setDependencyStatus("postgres", err)
 
-			return
-		}
+	if err != nil {
+		log.Printf("Failed to fetch recommendations from database: %v", err)
 
-		return
-	}
-	// Если данных нет в кэше, выполняем запрос к базе данных
-	log.Println("Not found recommendations in cache")
+		if cacheAvailable {
+			api.writeStale(w, staleKey)
 
-	var product []model.Recommendations
+			return
+		}
 
-	if err := api.DB.Order("popularity_score DESC").Limit(limit).Find(&product).Error; err != nil {
-		http.Error(w, "Failed to fetch recommendations", http.StatusInternalServerError)
+		http.Error(w, "Recommendations are temporarily unavailable", http.StatusServiceUnavailable)
 
 		return
 	}
@@ -79,18 +98,89 @@ func (api *APIHandler) GetRecommendations(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Сохраняем результат в кэше с TTL 1 минута
-	if err := api.Cache.Set(cacheKey, string(recommendationsJSON), 1*time.Minute); err != nil {
-		log.Printf("Failed to cache recommendations: %v", err)
+	// Сохраняем результат в кэше и копию на случай недоступности базы
+	if cacheAvailable {
+		if err := api.Cache.Set(cacheKey, string(recommendationsJSON), cacheTTL); err != nil {
+			log.Printf("Failed to cache recommendations: %v", err)
+		}
+
+		if err := api.Cache.Set(staleKey, string(recommendationsJSON), staleTTL); err != nil {
+			log.Printf("Failed to cache stale recommendations: %v", err)
+		}
 	}
 
 	// Возврат результата
-	w.Header().Set("Content-Type", "application/json")
+	writeRecommendations(w, string(recommendationsJSON))
+}
+
+// Продукт вместе с эпохой, в масштабе которой хранится его Score.
+type scoredProduct struct {
+	model.Recommendations `gorm:"embedded"`
+	Epoch                 *time.Time
+}
 
-	_, err = w.Write(recommendationsJSON)
+// Продукты по убыванию популярности с затуханием. Порядок по хранимому Score
+// совпадает с порядком по текущему значению, в ответ попадает текущее.
+// Эпоха читается тем же запросом, что и продукты, поэтому без блокировок
+// соответствует прочитанным значениям даже во время Rebase.
+func (api *APIHandler) fetchRecommendations(limit int) ([]model.Recommendations, error) {
+	var rows []scoredProduct
+
+	err := api.DB.Model(&model.Recommendations{}).
+		Select("recommendations.*, popularity_epoch.epoch AS epoch").
+		Joins("LEFT JOIN popularity_epoch ON popularity_epoch.id = ?", epochID).
+		Order("score DESC, popularity_score DESC").
+		Limit(limit).
+		Scan(&rows).Error
 	if err != nil {
-		log.Printf("Failed to writing data: %v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	product := make([]model.Recommendations, len(rows))
+
+	for i, row := range rows {
+		product[i] = row.Recommendations
+
+		// Без эпохи событий еще не было, значения не затухают
+		if row.Epoch != nil {
+			product[i].Score = api.Scoring.Decay(row.Score, *row.Epoch, now)
+		}
+	}
+
+	return product, nil
+}
+
+// Отдает последний сохраненный список, помечая ответ устаревшим.
+func (api *APIHandler) writeStale(w http.ResponseWriter, staleKey string) {
+	staleData, err := api.Cache.Get(staleKey)
+	setDependencyStatus("redis", err)
+
+	if err != nil || staleData == "" {
+		http.Error(w, "Recommendations are temporarily unavailable", http.StatusServiceUnavailable)
 
 		return
 	}
+
+	log.Println("Serving stale recommendations from cache")
+	w.Header().Set("Warning", `110 - "Response is Stale"`)
+	writeRecommendations(w, staleData)
+}
+
+func writeRecommendations(w http.ResponseWriter, data string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write([]byte(data)); err != nil {
+		log.Printf("Failed to writing data: %v", err)
+	}
+}
+
+// Обновляет метрику доступности зависимости по результату обращения к ней.
+func setDependencyStatus(dependency string, err error) {
+	up := 1.0
+	if err != nil {
+		up = 0
+	}
+
+	monitoring.DependencyUp.WithLabelValues(dependency).Set(up)
 }
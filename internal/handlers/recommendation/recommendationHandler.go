@@ -5,97 +5,204 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	ledger "Go-internship-Manifure/internal/db/ledger_db"
+	k "Go-internship-Manifure/internal/kafka"
 	"Go-internship-Manifure/internal/model"
+	"Go-internship-Manifure/internal/redis"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Handler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Cache  redis.CacheInterface
+	Ledger *ledger.Ledger // Журнал обработанных событий, без него событие применяется при каждой доставке
+
+	ProductTopic string // Топик событий продуктов, tombstone из других топиков пропускаются
+
+	Scoring *Scoring // Веса событий и затухание популярности
 }
 
 // Инициализация нового обработчика рекомендаций.
-func NewRecommendationHandler(db *gorm.DB) *Handler {
-	return &Handler{DB: db}
+func NewRecommendationHandler(db *gorm.DB, cache redis.CacheInterface, events *ledger.Ledger) *Handler {
+	return &Handler{DB: db, Cache: cache, Ledger: events, ProductTopic: "product-updates", Scoring: DefaultScoring()}
 }
 
 // Обработчик сообщений для сервиса рекомендаций.
 func (rh *Handler) HandleMessage(message []byte, topic kafka.TopicPartition, cn int) error {
 	log.Printf("Consumer #%d received message from topic %s: %s", cn, *topic.Topic, string(message))
-	// В зависимости от переданного топика kafka, выбирается обработчик
-	switch *topic.Topic {
-	case "product-updates":
-		return rh.HandleProductMessage(message)
-	case "user-updates":
-		return rh.HandleUserMessage(message)
+
+	event, err := model.ParseEvent(message)
+	if err != nil {
+		return k.Permanent(err)
+	}
+
+	if rh.Ledger == nil {
+		return rh.dispatch(event)
+	}
+
+	// Событие применяется в одной транзакции с записью в журнал,
+	// повторная доставка того же события пропускается
+	return rh.Ledger.Apply(event, func(tx *gorm.DB) error {
+		return rh.withDB(tx).dispatch(event)
+	})
+}
+
+// Копия обработчика, работающая в транзакции tx.
+func (rh *Handler) withDB(tx *gorm.DB) *Handler {
+	h := *rh
+	h.DB = tx
+
+	return &h
+}
+
+// Обработчик выбирается по типу события, неизвестные типы пропускаются.
+// Популярность учитывается на момент возникновения события.
+func (rh *Handler) dispatch(event *model.Event) error {
+	at := event.OccurredAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	switch event.Type {
+	case model.ProductCreated, model.ProductUpdated:
+		return rh.handleProduct(event.Payload, event.Type, at)
+	case model.ProductDeleted:
+		return rh.HandleProductDeleted(event.Payload)
+	case model.CartItemAdded:
+		// Корзина в событиях пользователя не учитывается, иначе товары
+		// считались бы повторно при каждом изменении профиля
+		return rh.handleCart(event.Payload, at)
 	default:
-		return fmt.Errorf("unknown topic: %s", *topic.Topic)
+		log.Printf("Skipping event %s of type %s", event.EventID, event.Type)
+
+		return nil
 	}
 }
 
 // Обработчик сообщений продукта.
 func (rh *Handler) HandleProductMessage(message []byte) error {
+	return rh.handleProduct(message, model.ProductUpdated, time.Now())
+}
+
+func (rh *Handler) handleProduct(message []byte, eventType string, at time.Time) error {
 	var product model.Recommendations
 	if err := json.Unmarshal(message, &product); err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+		return k.Permanent(fmt.Errorf("failed to unmarshal message: %w", err))
 	}
 
-	var existingProduct model.Recommendations
-	if err := rh.DB.Where("id = ?", product.ID).First(&existingProduct).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			product.PopularityScore = 1
-			if err := rh.DB.Create(&product).Error; err != nil {
-				return fmt.Errorf("failed to create recommendations: %w", err)
-			}
-
-			log.Printf("Recommended product #%s created with ID %s", product.ID, product.ID)
-		} else {
-			return fmt.Errorf("failed to get recommendations: %w", err)
-		}
-	} else {
-		existingProduct.PopularityScore++
-		if err := rh.DB.Save(&existingProduct).Error; err != nil {
-			return fmt.Errorf("failed to update recommendations: %w", err)
-		}
-
-		log.Printf("Updated product: %+v", existingProduct)
+	// Название и цена берутся из события, популярность увеличивается
+	if err := rh.increasePopularity(product, eventType, at, "name", "price"); err != nil {
+		return fmt.Errorf("failed to update recommendations: %w", err)
 	}
 
+	log.Printf("Recommended product #%s updated", product.ID)
+
 	return nil
 }
 
-// Обработчик сообщений пользователя.
-func (rh *Handler) HandleUserMessage(message []byte) error {
-	var user model.User
-	if err := json.Unmarshal(message, &user); err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+// Обработчик добавления товара в корзину, повышает популярность товара.
+func (rh *Handler) HandleCartMessage(message []byte) error {
+	return rh.handleCart(message, time.Now())
+}
+
+func (rh *Handler) handleCart(message []byte, at time.Time) error {
+	var event model.CartEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		return k.Permanent(fmt.Errorf("failed to unmarshal message: %w", err))
 	}
 
-	for _, cartItem := range user.Cart {
-		var product model.Recommendations
-		if err := rh.DB.Where("id = ?", cartItem.ProductID).First(&product).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				product.ID = cartItem.ProductID
-				product.PopularityScore = 1
-
-				if err := rh.DB.Create(&product).Error; err != nil {
-					return fmt.Errorf("failed to insert product from user cart: %w", err)
-				}
-
-				log.Printf("Product #%s created with ID %s", product.ID, product.ID)
-			} else {
-				return fmt.Errorf("failed to query product from user cart: %w", err)
-			}
-		} else {
-			product.PopularityScore++
-			if err := rh.DB.Save(&product).Error; err != nil {
-				return fmt.Errorf("failed to update product from user cart: %w", err)
-			}
-
-			log.Printf("Updated product: %+v", product)
-		}
+	return rh.increaseCartPopularity(event.ProductID, at)
+}
+
+// Обработчик удаления продукта.
+func (rh *Handler) HandleProductDeleted(message []byte) error {
+	var event model.ProductDeletedEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		return k.Permanent(fmt.Errorf("failed to unmarshal message: %w", err))
 	}
 
+	return rh.deleteProduct(event.ID)
+}
+
+// Обработчик tombstone из топика продуктов, ключ сообщения - id продукта.
+func (rh *Handler) HandleTombstone(key []byte, topic kafka.TopicPartition) error {
+	if *topic.Topic != rh.ProductTopic {
+		return nil
+	}
+
+	return rh.deleteProduct(string(key))
+}
+
+// Удаляет продукт из рекомендаций и сбрасывает закэшированные списки. Сброс
+// кэша не влияет на результат: без redis удаление не должно откатываться и
+// повторяться, а устаревший список истечет через cacheTTL.
+func (rh *Handler) deleteProduct(id string) error {
+	if id == "" {
+		return k.Permanent(errors.New("product id is required"))
+	}
+
+	if err := rh.DB.Delete(&model.Recommendations{}, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to delete recommendations: %w", err)
+	}
+
+	err := rh.Cache.DeletePrefix(cacheKeyPrefix)
+	setDependencyStatus("redis", err)
+
+	if err != nil {
+		log.Printf("Failed to invalidate recommendations cache: %v", err)
+	}
+
+	log.Printf("Product #%s removed from recommendations", id)
+
+	return nil
+}
+
+// Повышает популярность продукта из корзины, создавая запись при ее отсутствии.
+func (rh *Handler) increaseCartPopularity(productID string, at time.Time) error {
+	if err := rh.increasePopularity(model.Recommendations{ID: productID}, model.CartItemAdded, at); err != nil {
+		return fmt.Errorf("failed to update product from user cart: %w", err)
+	}
+
+	log.Printf("Popularity of product #%s increased", productID)
+
 	return nil
 }
+
+// Учитывает событие eventType в популярности продукта одним запросом
+// INSERT ... ON CONFLICT, чтобы параллельные обработчики не теряли обновления.
+// Счетчик событий увеличивается на 1, Score - на вес события в масштабе эпохи.
+// Новый продукт создается с этими значениями, у существующего дополнительно
+// обновляются columns.
+func (rh *Handler) increasePopularity(product model.Recommendations, eventType string, at time.Time, columns ...string) error {
+	return rh.DB.Transaction(func(tx *gorm.DB) error {
+		// Разделяемая блокировка не дает перенести эпоху до конца транзакции
+		epoch, err := currentEpoch(tx, clause.Locking{Strength: "SHARE"})
+		if err != nil {
+			return err
+		}
+
+		increment := rh.Scoring.increment(eventType, at, epoch)
+		product.PopularityScore = 1
+		product.Score = increment
+
+		updates := append(clause.AssignmentColumns(columns),
+			clause.Assignment{
+				Column: clause.Column{Name: "popularity_score"},
+				Value:  gorm.Expr("recommendations.popularity_score + ?", 1),
+			},
+			clause.Assignment{
+				Column: clause.Column{Name: "score"},
+				Value:  gorm.Expr("recommendations.score + ?", increment),
+			},
+		)
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: updates,
+		}).Create(&product).Error
+	})
+}
@@ -2,14 +2,19 @@ package recommendation_test
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	ledger "Go-internship-Manifure/internal/db/ledger_db"
 	"Go-internship-Manifure/internal/handlers/recommendation"
 	"Go-internship-Manifure/internal/model"
 	"Go-internship-Manifure/internal/redis"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -21,16 +26,27 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
+	// Одно соединение, чтобы транзакции работали с той же базой в памяти
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
 	// Миграция схемы
-	err = db.AutoMigrate(&model.Recommendations{})
+	err = db.AutoMigrate(&model.Recommendations{}, &model.PopularityEpoch{})
 	require.NoError(t, err)
+	require.NoError(t, testLedger(db).Migrate())
 
 	return db
 }
 
+// Журнал обработанных событий в тестовой базе.
+func testLedger(db *gorm.DB) *ledger.Ledger {
+	return ledger.NewLedger(db, "processed_events")
+}
+
 func TestHandleProductMessage(t *testing.T) {
 	db := setupTestDB(t)
-	handler := recommendation.NewRecommendationHandler(db)
+	handler := recommendation.NewRecommendationHandler(db, redis.NewCacheMock(), nil)
 
 	product := model.Recommendations{
 		ID:              "test-product-id",
@@ -54,40 +70,116 @@ func TestHandleProductMessage(t *testing.T) {
 	require.Equal(t, 1, savedProduct.PopularityScore) // Должно быть увеличено до 1
 }
 
-func TestHandleUserMessage(t *testing.T) {
+func TestHandleCartMessage(t *testing.T) {
 	db := setupTestDB(t)
-	handler := recommendation.NewRecommendationHandler(db)
-
-	// Создаем тестового пользователя с корзиной
-	user := model.User{
-		ID:       "test-user-id",
-		Name:     "John Doe",
-		Email:    "john@example.com",
-		Password: "test",
-		Cart: []struct {
-			ProductID string `json:"product_id"`
-		}{
-			{ProductID: "test-product-id-1"},
-			{ProductID: "test-product-id-2"},
-		},
+	handler := recommendation.NewRecommendationHandler(db, redis.NewCacheMock(), testLedger(db))
+	topic := "user-updates"
+
+	events := []struct {
+		eventType string
+		payload   model.CartEvent
+	}{
+		{model.CartItemAdded, model.CartEvent{UserID: "test-user-id", ProductID: "test-product-id", Quantity: 2}},
+		{model.CartItemAdded, model.CartEvent{UserID: "test-user-id", ProductID: "test-product-id", Quantity: 1}},
+		{model.CartItemRemoved, model.CartEvent{UserID: "test-user-id", ProductID: "test-product-id", Quantity: 3}},
+		{model.UserUpdated, model.CartEvent{UserID: "test-user-id"}},
+	}
+
+	for _, e := range events {
+		event, err := model.NewEvent(e.eventType, "user-service", e.payload)
+		require.NoError(t, err)
+
+		message, err := json.Marshal(event)
+		require.NoError(t, err)
+
+		err = handler.HandleMessage(message, kafka.TopicPartition{Topic: &topic}, 1)
+		require.NoError(t, err)
 	}
 
-	// Отправка сообщения о пользователе
-	message, err := json.Marshal(user)
+	// Удаление из корзины и события пользователя не влияют на популярность
+	var product model.Recommendations
+	require.NoError(t, db.First(&product, "id = ?", "test-product-id").Error)
+	require.Equal(t, 2, product.PopularityScore)
+}
+
+func TestHandleMessageRejectsUnsupportedSchema(t *testing.T) {
+	handler := recommendation.NewRecommendationHandler(setupTestDB(t), redis.NewCacheMock(), nil)
+	topic := "product-updates"
+
+	event, err := model.NewEvent(model.ProductCreated, "product-service", model.Recommendations{ID: "test-product-id"})
 	require.NoError(t, err)
 
-	err = handler.HandleUserMessage(message)
-	require.NoError(t, err, "handleUserMessage should not return an error")
+	event.SchemaVersion = model.EventSchemaVersion + 1
 
-	// Проверка, что продукты из корзины были добавлены с правильными данными
-	var product1, product2 model.Recommendations
-	err = db.First(&product1, "id = ?", "test-product-id-1").Error
+	message, err := json.Marshal(event)
 	require.NoError(t, err)
-	require.Equal(t, 1, product1.PopularityScore)
 
-	err = db.First(&product2, "id = ?", "test-product-id-2").Error
+	err = handler.HandleMessage(message, kafka.TopicPartition{Topic: &topic}, 1)
+	require.ErrorIs(t, err, model.ErrUnsupportedSchemaVersion)
+}
+
+func TestHandleProductDeleted(t *testing.T) {
+	db := setupTestDB(t)
+	cache := redis.NewCacheMock()
+	handler := recommendation.NewRecommendationHandler(db, cache, testLedger(db))
+	topic := "product-updates"
+
+	require.NoError(t, db.Create(&[]model.Recommendations{
+		{ID: "product1", Name: "Product 1", PopularityScore: 5},
+		{ID: "product2", Name: "Product 2", PopularityScore: 3},
+	}).Error)
+	require.NoError(t, cache.Set("recommendations:limit:10", "[]", time.Minute))
+
+	event, err := model.NewEvent(model.ProductDeleted, "product-service", model.ProductDeletedEvent{ID: "product1"})
 	require.NoError(t, err)
-	require.Equal(t, 1, product2.PopularityScore)
+
+	message, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	err = handler.HandleMessage(message, kafka.TopicPartition{Topic: &topic}, 1)
+	require.NoError(t, err)
+
+	// Продукт удален, закэшированные списки сброшены
+	require.ErrorIs(t, db.First(&model.Recommendations{}, "id = ?", "product1").Error, gorm.ErrRecordNotFound)
+
+	cached, err := cache.Get("recommendations:limit:10")
+	require.NoError(t, err)
+	require.Empty(t, cached)
+
+	// Tombstone удаляет продукт так же, повторное удаление не является ошибкой
+	require.NoError(t, handler.HandleTombstone([]byte("product2"), kafka.TopicPartition{Topic: &topic}))
+	require.NoError(t, handler.HandleTombstone([]byte("product2"), kafka.TopicPartition{Topic: &topic}))
+	require.ErrorIs(t, db.First(&model.Recommendations{}, "id = ?", "product2").Error, gorm.ErrRecordNotFound)
+}
+
+func TestHandleProductDeletedWithoutRedis(t *testing.T) {
+	db := setupTestDB(t)
+	handler := recommendation.NewRecommendationHandler(db, &unavailableCache{}, testLedger(db))
+	handler.ProductTopic = "catalog"
+
+	require.NoError(t, db.Create(&[]model.Recommendations{
+		{ID: "product1", Name: "Product 1", PopularityScore: 5},
+		{ID: "product2", Name: "Product 2", PopularityScore: 3},
+	}).Error)
+
+	event, err := model.NewEvent(model.ProductDeleted, "product-service", model.ProductDeletedEvent{ID: "product1"})
+	require.NoError(t, err)
+
+	message, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	// Недоступный redis не откатывает удаление
+	topic := "catalog"
+	require.NoError(t, handler.HandleMessage(message, kafka.TopicPartition{Topic: &topic}, 1))
+	require.ErrorIs(t, db.First(&model.Recommendations{}, "id = ?", "product1").Error, gorm.ErrRecordNotFound)
+
+	// Tombstone принимаются только из настроенного топика продуктов
+	other := "product-updates"
+	require.NoError(t, handler.HandleTombstone([]byte("product2"), kafka.TopicPartition{Topic: &other}))
+	require.NoError(t, db.First(&model.Recommendations{}, "id = ?", "product2").Error)
+
+	require.NoError(t, handler.HandleTombstone([]byte("product2"), kafka.TopicPartition{Topic: &topic}))
+	require.ErrorIs(t, db.First(&model.Recommendations{}, "id = ?", "product2").Error, gorm.ErrRecordNotFound)
 }
 
 func setupTestAPI(t *testing.T) (*gorm.DB, *redis.CacheMock, *recommendation.APIHandler) {
@@ -169,3 +261,135 @@ func TestGetRecommendations_WithCache(t *testing.T) {
 	require.Len(t, recommendations, 1)
 	require.Equal(t, "Cached Product 1", recommendations[0].Name) // Проверяем, что данные взяты из кэша
 }
+
+// Недоступный redis: все обращения завершаются ошибкой.
+type unavailableCache struct {
+	redis.CacheMock
+}
+
+var errRedisDown = errors.New("redis: connection refused")
+
+func (c *unavailableCache) Get(string) (string, error) { return "", errRedisDown }
+
+func (c *unavailableCache) Set(string, string, time.Duration) error { return errRedisDown }
+
+func (c *unavailableCache) DeletePrefix(string) error { return errRedisDown }
+
+func getRecommendations(t *testing.T, apiHandler *recommendation.APIHandler) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	apiHandler.GetRecommendations(rec, httptest.NewRequest(http.MethodGet, "/recommendations?limit=2", nil))
+
+	return rec
+}
+
+func TestGetRecommendationsDegraded(t *testing.T) {
+	db, cache, apiHandler := setupTestAPI(t)
+
+	require.NoError(t, db.Create(&model.Recommendations{ID: "product1", Name: "Product 1", PopularityScore: 5}).Error)
+
+	// Redis недоступен: список читается из базы
+	rec := getRecommendations(t, recommendation.NewRecommendationAPIHandler(db, &unavailableCache{}))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "Product 1")
+
+	// Успешный ответ сохраняет копию списка, которая переживает истечение кэша
+	require.Equal(t, http.StatusOK, getRecommendations(t, apiHandler).Code)
+	require.NoError(t, cache.DeletePrefix("recommendations:"))
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	// База недоступна: отдается последний сохраненный список
+	rec = getRecommendations(t, apiHandler)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "Product 1")
+	require.NotEmpty(t, rec.Header().Get("Warning"))
+
+	// Недоступны обе зависимости
+	rec = getRecommendations(t, recommendation.NewRecommendationAPIHandler(db, &unavailableCache{}))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestHandleMessageSkipsRedeliveredEvent(t *testing.T) {
+	db := setupTestDB(t)
+	handler := recommendation.NewRecommendationHandler(db, redis.NewCacheMock(), testLedger(db))
+	topic := "product-updates"
+
+	event, err := model.NewEvent(model.ProductUpdated, "product-service", model.Recommendations{ID: "test-product-id", Name: "Test Product"})
+	require.NoError(t, err)
+
+	message, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	// Повторная доставка того же события не меняет популярность
+	for range 3 {
+		require.NoError(t, handler.HandleMessage(message, kafka.TopicPartition{Topic: &topic}, 1))
+	}
+
+	var product model.Recommendations
+	require.NoError(t, db.First(&product, "id = ?", "test-product-id").Error)
+	require.Equal(t, 1, product.PopularityScore)
+}
+
+func TestConcurrentPopularityUpdatesAreNotLost(t *testing.T) {
+	// Файловая база с несколькими соединениями, чтобы обработчики работали параллельно.
+	// Транзакции сразу захватывают запись, иначе SQLite не повышает блокировку чтения эпохи
+	dsn := filepath.Join(t.TempDir(), "recommendations.db") + "?_busy_timeout=10000&_txlock=immediate"
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Recommendations{}, &model.PopularityEpoch{}))
+
+	handler := recommendation.NewRecommendationHandler(db, redis.NewCacheMock(), nil)
+
+	product := model.Recommendations{ID: "test-product-id", Name: "Test Product", Price: 100}
+
+	productMessage, err := json.Marshal(product)
+	require.NoError(t, err)
+
+	cartMessage, err := json.Marshal(model.CartEvent{UserID: "test-user-id", ProductID: product.ID, Quantity: 1})
+	require.NoError(t, err)
+
+	const (
+		workers         = 8
+		eventsPerWorker = 25
+	)
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 2*workers*eventsPerWorker)
+
+	for worker := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range eventsPerWorker {
+				// Половина обработчиков получает события продукта, половина - корзины
+				if worker%2 == 0 {
+					errs <- handler.HandleProductMessage(productMessage)
+				} else {
+					errs <- handler.HandleCartMessage(cartMessage)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Ни одно увеличение не потеряно, название и цена из события продукта не перезаписаны
+	var saved model.Recommendations
+	require.NoError(t, db.First(&saved, "id = ?", product.ID).Error)
+	require.Equal(t, workers*eventsPerWorker, saved.PopularityScore)
+	require.Equal(t, product.Name, saved.Name)
+	require.Equal(t, product.Price, saved.Price)
+}
@@ -0,0 +1,175 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"Go-internship-Manifure/internal/model"
+	"github.com/gorilla/mux"
+)
+
+const maxItemQuantity = 1000
+
+var errCartItemNotFound = errors.New("cart item not found")
+
+// Тело запроса добавления товара в корзину.
+type addCartItemRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Ответ с содержимым корзины.
+type cartResponse struct {
+	Items []model.CartItem `json:"items"`
+}
+
+// Получение корзины пользователя.
+func (uh *Handler) GetCart(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	user, err := uh.Users.GetUserByID(id)
+	if err != nil {
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	writeCart(w, user.Cart)
+}
+
+// Добавление товара в корзину, количество суммируется с уже добавленным.
+func (uh *Handler) AddCartItem(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req addCartItemRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	if req.ProductID == "" || req.Quantity < 0 || req.Quantity > maxItemQuantity {
+		http.Error(w, "Product id and quantity between 1 and 1000 are required", http.StatusBadRequest)
+
+		return
+	}
+
+	exists, err := uh.Products.ProductExists(req.ProductID)
+	if err != nil {
+		log.Printf("Failed to validate product %s: %v", req.ProductID, err)
+		http.Error(w, "Failed to validate product", http.StatusBadGateway)
+
+		return
+	}
+
+	if !exists {
+		http.Error(w, "Product not found", http.StatusUnprocessableEntity)
+
+		return
+	}
+
+	user, err := uh.Users.UpdateCart(id, func(cart []model.CartItem) ([]model.CartItem, []model.OutboxMessage, error) {
+		message, err := newCartMessage(model.CartItemAdded, id, model.CartItem{ProductID: req.ProductID, Quantity: req.Quantity})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		i := slices.IndexFunc(cart, func(item model.CartItem) bool { return item.ProductID == req.ProductID })
+		if i < 0 {
+			return append(cart, model.CartItem{ProductID: req.ProductID, Quantity: req.Quantity}), []model.OutboxMessage{message}, nil
+		}
+
+		cart[i].Quantity = min(cart[i].Quantity+req.Quantity, maxItemQuantity)
+
+		return cart, []model.OutboxMessage{message}, nil
+	})
+	if err != nil {
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	writeCart(w, user.Cart)
+}
+
+// Удаление товара из корзины.
+func (uh *Handler) RemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, productID := vars["id"], vars["product_id"]
+
+	user, err := uh.Users.UpdateCart(id, func(cart []model.CartItem) ([]model.CartItem, []model.OutboxMessage, error) {
+		i := slices.IndexFunc(cart, func(item model.CartItem) bool { return item.ProductID == productID })
+		if i < 0 {
+			return nil, nil, errCartItemNotFound
+		}
+
+		message, err := newCartMessage(model.CartItemRemoved, id, cart[i])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return slices.Delete(cart, i, i+1), []model.OutboxMessage{message}, nil
+	})
+	if err != nil {
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	writeCart(w, user.Cart)
+}
+
+// Очистка корзины, для каждого товара отправляется событие удаления.
+func (uh *Handler) ClearCart(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	_, err := uh.Users.UpdateCart(id, func(cart []model.CartItem) ([]model.CartItem, []model.OutboxMessage, error) {
+		messages := make([]model.OutboxMessage, 0, len(cart))
+
+		for _, item := range cart {
+			message, err := newCartMessage(model.CartItemRemoved, id, item)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			messages = append(messages, message)
+		}
+
+		return []model.CartItem{}, messages, nil
+	})
+	if err != nil {
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Формирует сообщение outbox об изменении корзины, ключ - id пользователя.
+func newCartMessage(eventType, userID string, item model.CartItem) (model.OutboxMessage, error) {
+	return newOutboxMessage(eventType, userID, model.CartEvent{UserID: userID, ProductID: item.ProductID, Quantity: item.Quantity})
+}
+
+func writeCart(w http.ResponseWriter, cart []model.CartItem) {
+	if cart == nil {
+		cart = []model.CartItem{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(cartResponse{Items: cart})
+	if err != nil {
+		http.Error(w, "Failed to encode cart", http.StatusInternalServerError)
+
+		return
+	}
+}
@@ -3,76 +3,99 @@ package user
 import (
 	"Go-internship-Manifure/internal/auth"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 
-	"Go-internship-Manifure/internal/kafka"
+	"Go-internship-Manifure/internal/catalog"
+	"Go-internship-Manifure/internal/db/user_db"
 	"Go-internship-Manifure/internal/model"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// Имя сервиса в поле producer событий.
+const eventProducer = "user-service"
+
+// События отправляются в kafka через outbox хранилища пользователей.
 type Handler struct {
-	Users         map[string]model.User
-	KafkaProducer kafka.ProducerInterface
+	Users    db.UserRepository
+	Products catalog.ProductCatalog
 }
 
 // Создание нового обработчика пользователя.
-func NewUserHandler(kafkaProducer kafka.ProducerInterface) *Handler {
+func NewUserHandler(users db.UserRepository, products catalog.ProductCatalog) *Handler {
 	return &Handler{
-		Users:         make(map[string]model.User),
-		KafkaProducer: kafkaProducer,
+		Users:    users,
+		Products: products,
 	}
 }
 
+// Тело запросов регистрации, обновления и входа. Пароль принимается только на вход.
+type credentialsRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 // Регистрация нового пользователя.
 func (uh *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
-	var user model.User
+	var req credentialsRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
 		return
 	}
 
-	if user.Name == "" || user.Email == "" || user.Password == "" {
+	req.Email = normalizeEmail(req.Email)
+
+	if req.Name == "" || req.Email == "" || req.Password == "" {
 		http.Error(w, "User name, email and password are required", http.StatusBadRequest)
 
 		return
 	}
 
-	user.ID = uuid.New().String()
-	uh.Users[user.ID] = user
-
-	message, err := json.Marshal(user)
+	passwordHash, err := auth.HashPassword(req.Password)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
 		return
 	}
 
-	// Генерирует JWT токен при регистрации нового пользователя
-	token, err := auth.GenerateJWT(user.ID)
+	user := model.User{
+		ID:           uuid.New().String(),
+		Name:         req.Name,
+		Email:        req.Email,
+		PasswordHash: passwordHash,
+		Role:         auth.RoleUser,
+	}
+
+	message, err := newOutboxMessage(model.UserRegistered, user.ID, user)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		http.Error(w, "Failed to create event", http.StatusInternalServerError)
+
 		return
 	}
 
-	err = uh.KafkaProducer.Produce(string(message))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := uh.Users.CreateUser(&user, message); err != nil {
+		writeRepositoryError(w, err)
 
 		return
 	}
 
+	// Генерирует JWT токены при регистрации нового пользователя
+	tokens, err := auth.GenerateTokenPair(user.ID, user.Role)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 
-	response := map[string]string{
-		"user_id": user.ID,
-		"token":   token,
-	}
-
-	err = json.NewEncoder(w).Encode(response)
+	err = json.NewEncoder(w).Encode(newTokenResponse(user.ID, tokens))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
@@ -83,17 +106,17 @@ func (uh *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 // Получение пользователя по id.
 func (uh *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	user, ok := uh.Users[id]
 
-	if !ok {
-		http.Error(w, "User not found", http.StatusNotFound)
+	user, err := uh.Users.GetUserByID(id)
+	if err != nil {
+		writeRepositoryError(w, err)
 
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	err := json.NewEncoder(w).Encode(user)
+	err = json.NewEncoder(w).Encode(user)
 	if err != nil {
 		http.Error(w, "Failed to encode user data", http.StatusInternalServerError)
 
@@ -105,7 +128,7 @@ func (uh *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 func (uh *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	var updatedUser model.User
+	var updatedUser credentialsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&updatedUser); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -113,9 +136,9 @@ func (uh *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, ok := uh.Users[id]
-	if !ok {
-		http.Error(w, "User not found", http.StatusNotFound)
+	user, err := uh.Users.GetUserByID(id)
+	if err != nil {
+		writeRepositoryError(w, err)
 
 		return
 	}
@@ -125,35 +148,253 @@ func (uh *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if updatedUser.Email != "" {
-		user.Email = updatedUser.Email
+		user.Email = normalizeEmail(updatedUser.Email)
 	}
 
 	if updatedUser.Password != "" {
-		user.Password = updatedUser.Password
+		user.PasswordHash, err = auth.HashPassword(updatedUser.Password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	message, err := newOutboxMessage(model.UserUpdated, user.ID, user)
+	if err != nil {
+		http.Error(w, "Failed to create event", http.StatusInternalServerError)
+
+		return
+	}
+
+	if err := uh.Users.UpdateUser(user, message); err != nil {
+		writeRepositoryError(w, err)
+
+		return
 	}
 
-	uh.Users[id] = user
+	w.WriteHeader(http.StatusOK)
 
-	message, err := json.Marshal(user)
+	err = json.NewEncoder(w).Encode(user)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
 		return
 	}
+}
 
-	err = uh.KafkaProducer.Produce(string(message))
-	if err != nil {
+// Вход по email и паролю, выдает новый JWT токен.
+func (uh *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req credentialsRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	if req.Email == "" || req.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
 
-	err = json.NewEncoder(w).Encode(user)
+		return
+	}
+
+	var passwordHash string
+
+	user, err := uh.Users.GetUserByEmail(normalizeEmail(req.Email))
+	if err == nil {
+		passwordHash = user.PasswordHash
+	} else if !errors.Is(err, db.ErrUserNotFound) {
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	// Для неизвестного email проверка выполняется с пустым хэшем, ответ одинаковый
+	if err := auth.CheckPassword(passwordHash, req.Password); err != nil {
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+
+		return
+	}
+
+	tokens, err := auth.GenerateTokenPair(user.ID, user.Role)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+
+		return
+	}
+
+	writeTokens(w, user.ID, tokens)
+}
+
+// Тело запросов обновления токенов и выхода.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Ответ с выданными токенами.
+type tokenResponse struct {
+	UserID       string `json:"user_id"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func newTokenResponse(userID string, tokens auth.TokenPair) tokenResponse {
+	return tokenResponse{
+		UserID:       userID,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}
+}
+
+func writeTokens(w http.ResponseWriter, userID string, tokens auth.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(newTokenResponse(userID, tokens))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
 		return
 	}
 }
+
+// Обмен токена обновления на новую пару токенов.
+func (uh *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+
+		return
+	}
+
+	claims, err := auth.ConsumeRefreshToken(req.RefreshToken)
+	if err != nil {
+		writeTokenError(w, err)
+
+		return
+	}
+
+	// Роль берется из базы, чтобы изменения прав применялись при обновлении токенов
+	user, err := uh.Users.GetUserByID(claims.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+
+			return
+		}
+
+		writeRepositoryError(w, err)
+
+		return
+	}
+
+	tokens, err := auth.GenerateTokenPair(user.ID, user.Role)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+
+		return
+	}
+
+	writeTokens(w, user.ID, tokens)
+}
+
+// Выход: отзывает текущий токен доступа и, если передан, токен обновления.
+func (uh *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	var req refreshRequest
+
+	// Тело запроса необязательно
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		refreshClaims, err := auth.ParseToken(req.RefreshToken, auth.TokenTypeRefresh)
+		if err != nil && !errors.Is(err, auth.ErrTokenRevoked) {
+			writeTokenError(w, err)
+
+			return
+		}
+
+		if err == nil {
+			if refreshClaims.UserID != claims.UserID {
+				http.Error(w, "Refresh token belongs to another user", http.StatusForbidden)
+
+				return
+			}
+
+			if err := auth.RevokeToken(refreshClaims); err != nil {
+				writeTokenError(w, err)
+
+				return
+			}
+		}
+	}
+
+	if err := auth.RevokeToken(claims); err != nil {
+		writeTokenError(w, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Преобразует ошибку проверки токена в HTTP ответ.
+func writeTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+
+		return
+	}
+
+	log.Printf("Token error: %v", err)
+	http.Error(w, "Failed to process token", http.StatusServiceUnavailable)
+}
+
+// Приводит email к единому виду для хранения и поиска.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Формирует сообщение outbox с событием сервиса пользователей, ключ - id сущности.
+func newOutboxMessage(eventType, key string, payload any) (model.OutboxMessage, error) {
+	event, err := model.NewEvent(eventType, eventProducer, payload)
+	if err != nil {
+		return model.OutboxMessage{}, err
+	}
+
+	return model.NewOutboxMessage(key, event)
+}
+
+// Преобразует ошибку хранилища в HTTP ответ.
+func writeRepositoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrEmailTaken):
+		http.Error(w, "Email already registered", http.StatusConflict)
+	case errors.Is(err, errCartItemNotFound):
+		http.Error(w, "Product not found in cart", http.StatusNotFound)
+	default:
+		log.Printf("User repository error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -3,37 +3,61 @@ package user_test
 import (
 	"bytes"
 	"encoding/json"
-	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
-	"time"
 
+	"Go-internship-Manifure/internal/auth"
+	"Go-internship-Manifure/internal/catalog"
+	"Go-internship-Manifure/internal/db/user_db"
 	"Go-internship-Manifure/internal/handlers/user"
 	"Go-internship-Manifure/internal/kafka"
 	"Go-internship-Manifure/internal/model"
 	"github.com/gorilla/mux"
 )
 
-var jwtKey = []byte("your_secret_key")
+type registerRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
 
 func generateTestJWT(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+	tokens, err := auth.GenerateTokenPair(userID, auth.RoleUser)
+
+	return tokens.AccessToken, err
+}
+
+func TestMain(m *testing.M) {
+	keys, err := auth.GenerateKeySet()
+	if err != nil {
+		panic(err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	auth.SetSigningKeys(keys)
 
-	return token.SignedString(jwtKey)
+	os.Exit(m.Run())
+}
+
+func setupTestRepository(t *testing.T) *db.UserDatabase {
+	t.Helper()
+
+	database, err := db.NewSQLiteUserDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+
+	return database
 }
 
 func TestRegisterUser(t *testing.T) {
-	mockProducer := &kafka.MockProducer{}
-	handler := user.NewUserHandler(mockProducer)
+	repository := setupTestRepository(t)
+	handler := user.NewUserHandler(repository, &catalog.MockCatalog{})
 
 	// Создание тестового HTTP-запроса
-	userData := model.User{ID: "123", Name: "John Doe", Email: "john@example.com", Password: "password"}
+	userData := registerRequest{Name: "John Doe", Email: "john@example.com", Password: "password"}
 
 	body, err := json.Marshal(userData)
 	if err != nil {
@@ -54,25 +78,26 @@ func TestRegisterUser(t *testing.T) {
 		t.Errorf("unexpected status code: got %v, want %v", status, http.StatusCreated)
 	}
 
+	producer := relayOutbox(t, repository.Outbox)
+
 	// Проверка Kafka Producer
-	if len(mockProducer.Messages) != 1 {
-		t.Fatalf("expected 1 message, got %d", len(mockProducer.Messages))
+	if len(producer.Values()) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(producer.Values()))
+	}
+
+	// Пароль и его хэш не должны попадать в kafka
+	if strings.Contains(producer.Values()[0], "password") {
+		t.Fatalf("password leaked to kafka message: %s", producer.Values()[0])
 	}
 }
 
 func TestGetUser(t *testing.T) {
 	// Создаю мок-продюсер и обработчик
-	mockProducer := &kafka.MockProducer{}
-	handler := user.NewUserHandler(mockProducer)
+	repository := setupTestRepository(t)
+	handler := user.NewUserHandler(repository, &catalog.MockCatalog{})
 
 	// Создаю нового пользователя
-	userData := model.User{
-		ID: "123", Name: "John Doe", Email: "john@example.com", Password: "password", Cart: []struct {
-			ProductID string `json:"product_id"`
-		}{
-			{ProductID: "test-product-id-1"},
-		},
-	}
+	userData := registerRequest{Name: "John Doe", Email: "john@example.com", Password: "password"}
 
 	body, err := json.Marshal(userData)
 	if err != nil {
@@ -109,7 +134,7 @@ func TestGetUser(t *testing.T) {
 	}
 
 	// Убедиться, что пользователь сохранен
-	if _, exists := handler.Users[userID]; !exists {
+	if _, err := handler.Users.GetUserByID(userID); err != nil {
 		t.Fatalf("user not saved in handler: %+v", userData)
 	}
 
@@ -127,6 +152,10 @@ func TestGetUser(t *testing.T) {
 		t.Errorf("unexpected status code: got %v, want %v", getUserRR.Code, http.StatusOK)
 	}
 
+	if strings.Contains(getUserRR.Body.String(), "password") {
+		t.Fatalf("password leaked to response: %s", getUserRR.Body.String())
+	}
+
 	// Проверка, что пользователь возвращен корректно
 	var fetchedUser model.User
 
@@ -139,3 +168,257 @@ func TestGetUser(t *testing.T) {
 		t.Errorf("unexpected user data: got %+v, want %+v", fetchedUser, userData)
 	}
 }
+
+func TestRegisterUserDuplicateEmail(t *testing.T) {
+	repository := setupTestRepository(t)
+	handler := user.NewUserHandler(repository, &catalog.MockCatalog{})
+
+	userData := registerRequest{Name: "John Doe", Email: "john@example.com", Password: "password"}
+
+	body, err := json.Marshal(userData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := make([]int, 0, 2)
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+		responseRecorder := httptest.NewRecorder()
+		handler.RegisterUser(responseRecorder, req)
+		codes = append(codes, responseRecorder.Code)
+	}
+
+	if codes[0] != http.StatusCreated || codes[1] != http.StatusConflict {
+		t.Fatalf("unexpected status codes: got %v, want [%d %d]", codes, http.StatusCreated, http.StatusConflict)
+	}
+
+	producer := relayOutbox(t, repository.Outbox)
+
+	// Повторная регистрация не должна отправлять сообщение в kafka
+	if len(producer.Values()) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(producer.Values()))
+	}
+}
+
+func TestLogin(t *testing.T) {
+	handler := user.NewUserHandler(setupTestRepository(t), &catalog.MockCatalog{})
+
+	body, err := json.Marshal(registerRequest{Name: "John Doe", Email: "John@Example.com", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	handler.RegisterUser(responseRecorder, httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body)))
+
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("failed to create user: got %v, want %v", responseRecorder.Code, http.StatusCreated)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     int
+	}{
+		{name: "valid credentials", email: "john@example.com", password: "password", want: http.StatusOK},
+		{name: "wrong password", email: "john@example.com", password: "wrong", want: http.StatusUnauthorized},
+		{name: "unknown email", email: "jane@example.com", password: "password", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(registerRequest{Email: tt.email, Password: tt.password})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			responseRecorder := httptest.NewRecorder()
+			handler.Login(responseRecorder, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body)))
+
+			if responseRecorder.Code != tt.want {
+				t.Fatalf("unexpected status code: got %v, want %v", responseRecorder.Code, tt.want)
+			}
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var response map[string]string
+			if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response body: %v", err)
+			}
+
+			if response["token"] == "" || response["user_id"] == "" {
+				t.Fatalf("token not returned in response: %v", response)
+			}
+		})
+	}
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	handler := user.NewUserHandler(setupTestRepository(t), &catalog.MockCatalog{})
+
+	body, err := json.Marshal(registerRequest{Name: "John Doe", Email: "john@example.com", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	handler.RegisterUser(responseRecorder, httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body)))
+
+	var registered map[string]string
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&registered); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/token/refresh", handler.RefreshToken).Methods(http.MethodPost)
+	router.Handle("/logout", auth.JWTMiddleware(http.HandlerFunc(handler.Logout))).Methods(http.MethodPost)
+
+	post := func(path, token, refreshToken string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]string{"refresh_token": refreshToken})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", token)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	refreshed := post("/token/refresh", "", registered["refresh_token"])
+	if refreshed.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %v, want %v", refreshed.Code, http.StatusOK)
+	}
+
+	var tokens map[string]string
+	if err := json.NewDecoder(refreshed.Body).Decode(&tokens); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+
+	// Старый токен обновления после ротации недействителен
+	if rec := post("/token/refresh", "", registered["refresh_token"]); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status code: got %v, want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	if rec := post("/logout", tokens["token"], tokens["refresh_token"]); rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code: got %v, want %v", rec.Code, http.StatusNoContent)
+	}
+
+	// После выхода не работают ни токен доступа, ни токен обновления
+	if rec := post("/logout", tokens["token"], ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status code: got %v, want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	if rec := post("/token/refresh", "", tokens["refresh_token"]); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status code: got %v, want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCart(t *testing.T) {
+	users := setupTestRepository(t)
+	products := &catalog.MockCatalog{Products: map[string]bool{"product-1": true, "product-2": true}}
+	handler := user.NewUserHandler(users, products)
+
+	if err := users.CreateUser(&model.User{ID: "user-1", Name: "John Doe", Email: "john@example.com", PasswordHash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}/cart", handler.GetCart).Methods(http.MethodGet)
+	router.HandleFunc("/users/{id}/cart", handler.AddCartItem).Methods(http.MethodPost)
+	router.HandleFunc("/users/{id}/cart", handler.ClearCart).Methods(http.MethodDelete)
+	router.HandleFunc("/users/{id}/cart/{product_id}", handler.RemoveCartItem).Methods(http.MethodDelete)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+		return rec
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"add item", http.MethodPost, "/users/user-1/cart", `{"product_id":"product-1","quantity":2}`, http.StatusOK},
+		{"add same item", http.MethodPost, "/users/user-1/cart", `{"product_id":"product-1"}`, http.StatusOK},
+		{"add second item", http.MethodPost, "/users/user-1/cart", `{"product_id":"product-2"}`, http.StatusOK},
+		{"unknown product", http.MethodPost, "/users/user-1/cart", `{"product_id":"missing"}`, http.StatusUnprocessableEntity},
+		{"invalid quantity", http.MethodPost, "/users/user-1/cart", `{"product_id":"product-1","quantity":-1}`, http.StatusBadRequest},
+		{"unknown user", http.MethodPost, "/users/user-2/cart", `{"product_id":"product-1"}`, http.StatusNotFound},
+		{"remove item", http.MethodDelete, "/users/user-1/cart/product-2", "", http.StatusOK},
+		{"remove missing item", http.MethodDelete, "/users/user-1/cart/product-2", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := do(tt.method, tt.path, tt.body); rec.Code != tt.want {
+				t.Fatalf("unexpected status code: got %v, want %v: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	rec := do(http.MethodGet, "/users/user-1/cart", "")
+
+	var cart struct {
+		Items []model.CartItem `json:"items"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&cart); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+
+	if len(cart.Items) != 1 || cart.Items[0] != (model.CartItem{ProductID: "product-1", Quantity: 3}) {
+		t.Fatalf("unexpected cart: %+v", cart.Items)
+	}
+
+	if rec := do(http.MethodDelete, "/users/user-1/cart", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code: got %v, want %v", rec.Code, http.StatusNoContent)
+	}
+
+	producer := relayOutbox(t, users.Outbox)
+
+	// Три добавления, удаление второго товара и удаление первого при очистке
+	var removed int
+	for _, message := range producer.Values() {
+		event, err := model.ParseEvent([]byte(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if event.Type == model.CartItemRemoved {
+			removed++
+		}
+	}
+
+	if len(producer.Values()) != 5 || removed != 2 {
+		t.Fatalf("unexpected cart events: %v", producer.Values())
+	}
+	// События одного пользователя попадают в одну партицию
+	for _, message := range producer.Messages {
+		if message.Key != "user-1" || message.Partition != producer.Messages[0].Partition {
+			t.Fatalf("unexpected kafka key or partition: %q, %d", message.Key, message.Partition)
+		}
+	}
+}
+
+// Отправляет накопленные в outbox сообщения в продюсер в памяти.
+func relayOutbox(t *testing.T, store kafka.OutboxStore) *kafka.MemoryProducer {
+	t.Helper()
+
+	producer := kafka.NewMemoryProducer(3)
+	if _, err := kafka.NewOutboxRelay("test", store, producer).RelayOnce(); err != nil {
+		t.Fatalf("failed to relay outbox: %v", err)
+	}
+
+	return producer
+}
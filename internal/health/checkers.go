@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"Go-internship-Manifure/internal/redis"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"gorm.io/gorm"
+)
+
+// Таймаут запроса метаданных kafka, если у контекста нет срока.
+const defaultKafkaTimeout = 5 * time.Second
+
+// Проверка соединения с базой данных.
+func Database(conn *gorm.DB) Checker {
+	return CheckFunc(func(ctx context.Context) error {
+		sqlDB, err := conn.DB()
+		if err != nil {
+			return err
+		}
+
+		return sqlDB.PingContext(ctx)
+	})
+}
+
+// Проверка redis командой PING.
+func Redis(cache *redis.Cache) Checker {
+	return CheckFunc(func(ctx context.Context) error {
+		return cache.Client.Ping(ctx).Err()
+	})
+}
+
+// Клиент kafka, умеющий запрашивать метаданные кластера: producer или consumer.
+type MetadataClient interface {
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+}
+
+// Проверка kafka запросом метаданных кластера.
+func Kafka(client MetadataClient) Checker {
+	return CheckFunc(func(ctx context.Context) error {
+		timeout := defaultKafkaTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+
+		metadata, err := client.GetMetadata(nil, false, int(timeout.Milliseconds()))
+		if err != nil {
+			return err
+		}
+
+		if len(metadata.Brokers) == 0 {
+			return errors.New("no kafka brokers available")
+		}
+
+		return nil
+	})
+}
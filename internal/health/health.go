@@ -0,0 +1,187 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"Go-internship-Manifure/internal/monitoring"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+
+	// Недоступна необязательная зависимость, сервис работает с ограничениями
+	StatusDegraded = "degraded"
+)
+
+// Проверка доступности зависимости.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Функция, реализующая Checker.
+type CheckFunc func(ctx context.Context) error
+
+func (f CheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Результат одной проверки.
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Отчет о готовности сервиса.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type namedChecker struct {
+	name     string
+	checker  Checker
+	optional bool
+}
+
+// Health выполняет проверки зависимостей сервиса. Каждая проверка
+// ограничена таймаутом, проверки выполняются параллельно.
+type Health struct {
+	timeout time.Duration
+
+	mu       sync.RWMutex
+	checkers []namedChecker
+}
+
+// Создает набор проверок с таймаутом timeout на каждую проверку.
+func New(timeout time.Duration) *Health {
+	return &Health{timeout: timeout}
+}
+
+// Добавляет проверку зависимости.
+func (h *Health) Add(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checkers = append(h.checkers, namedChecker{name: name, checker: checker})
+}
+
+// Добавляет проверку зависимости, без которой сервис продолжает работать.
+// Ее недоступность переводит отчет в статус degraded, но не в down.
+func (h *Health) AddOptional(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checkers = append(h.checkers, namedChecker{name: name, checker: checker, optional: true})
+}
+
+// Выполняет все проверки и обновляет метрики готовности.
+func (h *Health) Check(ctx context.Context) Report {
+	h.mu.RLock()
+	checkers := h.checkers
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checkers))
+
+	var wg sync.WaitGroup
+
+	for i, c := range checkers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i] = h.run(ctx, c)
+		}()
+	}
+
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: results}
+
+	for i, result := range results {
+		up := 1.0
+		if result.Status != StatusUp {
+			up = 0
+
+			if !checkers[i].optional {
+				report.Status = StatusDown
+			} else if report.Status == StatusUp {
+				report.Status = StatusDegraded
+			}
+		}
+
+		monitoring.ReadinessCheckStatus.WithLabelValues(result.Name).Set(up)
+	}
+
+	if report.Status != StatusDown {
+		monitoring.ServiceReady.Set(1)
+	} else {
+		monitoring.ServiceReady.Set(0)
+	}
+
+	return report
+}
+
+func (h *Health) run(ctx context.Context, c namedChecker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// Проверка, не уложившаяся в таймаут, считается неуспешной, даже если
+	// сама не учитывает контекст
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{
+		Name:      c.name,
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// Liveness: процесс запущен и обрабатывает запросы.
+func LiveHandler(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": StatusUp})
+}
+
+// Readiness: отчет о проверках, 503 если недоступна хотя бы одна обязательная зависимость.
+func (h *Health) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+
+	status := http.StatusOK
+	if report.Status == StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
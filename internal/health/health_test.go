@@ -0,0 +1,105 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/health"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestReadyHandler(t *testing.T) {
+	h := health.New(time.Second)
+	h.Add("postgres", health.CheckFunc(func(context.Context) error { return nil }))
+
+	rec := httptest.NewRecorder()
+	h.ReadyHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	h.Add("redis", health.CheckFunc(func(context.Context) error { return errors.New("connection refused") }))
+
+	rec = httptest.NewRecorder()
+	h.ReadyHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var report health.Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+
+	require.Equal(t, health.StatusDown, report.Status)
+	require.Len(t, report.Checks, 2)
+	require.Equal(t, health.StatusUp, report.Checks[0].Status)
+	require.Equal(t, "redis", report.Checks[1].Name)
+	require.Equal(t, health.StatusDown, report.Checks[1].Status)
+	require.Equal(t, "connection refused", report.Checks[1].Error)
+}
+
+func TestOptionalCheck(t *testing.T) {
+	h := health.New(time.Second)
+	h.Add("postgres", health.CheckFunc(func(context.Context) error { return nil }))
+	h.AddOptional("redis", health.CheckFunc(func(context.Context) error { return errors.New("connection refused") }))
+
+	rec := httptest.NewRecorder()
+	h.ReadyHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	// Без необязательной зависимости сервис остается готовым
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var report health.Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.Equal(t, health.StatusDegraded, report.Status)
+
+	h.Add("kafka", health.CheckFunc(func(context.Context) error { return errors.New("no brokers") }))
+	require.Equal(t, health.StatusDown, h.Check(context.Background()).Status)
+}
+
+func TestCheckTimeout(t *testing.T) {
+	h := health.New(20 * time.Millisecond)
+
+	// Проверка не учитывает контекст и зависает
+	block := make(chan struct{})
+	defer close(block)
+
+	h.Add("kafka", health.CheckFunc(func(context.Context) error {
+		<-block
+
+		return nil
+	}))
+
+	start := time.Now()
+	report := h.Check(context.Background())
+
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, health.StatusDown, report.Status)
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Checks[0].Error)
+}
+
+func TestLiveHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	health.LiveHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"up"}`, rec.Body.String())
+}
+
+func TestDatabaseChecker(t *testing.T) {
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	checker := health.Database(conn)
+	require.NoError(t, checker.Check(context.Background()))
+
+	sqlDB, err := conn.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	require.Error(t, checker.Check(context.Background()))
+}
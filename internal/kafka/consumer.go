@@ -2,29 +2,96 @@ package kafka
 
 import (
 	"context"
-	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Go-internship-Manifure/internal/monitoring"
+	"Go-internship-Manifure/internal/retry"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
 const (
 	sessionTimeout     = 7000 // ms
 	autoCommitInterval = 5000
-	readTimeout        = 10000
+
+	// Ожидание сообщения, после которого проверяется отмена контекста
+	readTimeout = 500 * time.Millisecond
+
+	deadLetterSuffix = ".dlq"
+
+	workerQueueSize = 64               // Размер очереди сообщений одного обработчика
+	drainTimeout    = 30 * time.Second // Ожидание обработки сообщений отозванных партиций
+)
+
+// Заголовки, которые добавляются к сообщению при отправке в DLQ.
+const (
+	HeaderDLQError     = "dlq.error"
+	HeaderDLQPermanent = "dlq.permanent"
+	HeaderDLQAttempts  = "dlq.attempts"
+	HeaderDLQTopic     = "dlq.original_topic"
+	HeaderDLQPartition = "dlq.original_partition"
+	HeaderDLQOffset    = "dlq.original_offset"
+	HeaderDLQFailedAt  = "dlq.failed_at"
 )
 
+// cn - номер обработчика, начиная с 1.
 type Handler interface {
 	HandleMessage(message []byte, topic kafka.TopicPartition, cn int) error
 }
 
+// Обработчик tombstone сообщений (ключ без значения). Если обработчик его
+// не реализует, tombstone пропускаются.
+type TombstoneHandler interface {
+	HandleTombstone(key []byte, topic kafka.TopicPartition) error
+}
+
+// Политика повторной обработки сообщений по умолчанию: 5 попыток
+// с задержкой от 100 мс до 10 с.
+func DefaultRetryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+	}
+}
+
+// Consumer раздает сообщения нескольким обработчикам. Сообщения с одним ключом
+// (без ключа - из одной партиции) обрабатываются одним обработчиком по порядку,
+// а смещение партиции фиксируется, только когда обработаны все более ранние сообщения.
 type Consumer struct {
-	Consumer       *kafka.Consumer
-	Handler        Handler
-	consumerNumber int
+	Consumer *kafka.Consumer
+	Handler  Handler
+
+	Retry      retry.Policy
+	DeadLetter ProducerInterface // Сообщения, которые не удалось обработать, отправляются в <topic>.dlq
+
+	workers  int
+	offsets  *offsetTracker
+	stopping atomic.Bool // Start завершается, оставшиеся в очередях сообщения не обрабатываются
+
+	// Закрытый клиент kafka освобождает память, поэтому после Close к нему
+	// нельзя обращаться. Close дожидается текущих запросов метаданных.
+	closed atomic.Bool
+	mu     sync.RWMutex
 }
 
-// Подключается к kafka и инициализирует новый consumer.
-func NewConsumer(handler Handler, address, topic []string, consumerGroup string, consumerNumber int) (*Consumer, error) {
+var ErrConsumerClosed = errors.New("consumer is closed")
+
+// Источник сообщений и хранилище смещений, реализуется *kafka.Consumer.
+type messageSource interface {
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+}
+
+// Подключается к kafka и инициализирует новый consumer с workers обработчиками.
+func NewConsumer(handler Handler, address, topic []string, consumerGroup string, workers int) (*Consumer, error) {
 	cfg := &kafka.ConfigMap{
 		"bootstrap.servers":        strings.Join(address, ","),
 		"group.id":                 consumerGroup,
@@ -40,20 +107,59 @@ func NewConsumer(handler Handler, address, topic []string, consumerGroup string,
 		return nil, err
 	}
 
-	err = consumer.SubscribeTopics(topic, nil)
+	c := &Consumer{
+		Consumer: consumer,
+		Handler:  handler,
+		Retry:    DefaultRetryPolicy(),
+		workers:  max(workers, 1),
+		offsets:  newOffsetTracker(),
+	}
+
+	err = consumer.SubscribeTopics(topic, c.rebalance)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Consumer{
-		Consumer:       consumer,
-		Handler:        handler,
-		consumerNumber: consumerNumber,
-	}, nil
+	return c, nil
 }
 
-// Запуск обработчика сообщений kafka.
+// Запуск обработчика сообщений kafka. Возвращает управление после отмены
+// контекста, когда все обработчики остановлены.
 func (c *Consumer) Start(ctx context.Context) {
+	c.run(ctx, c.Consumer)
+}
+
+func (c *Consumer) run(ctx context.Context, source messageSource) {
+	if c.offsets == nil {
+		c.offsets = newOffsetTracker()
+	}
+
+	workers := max(c.workers, 1)
+	queues := make([]chan *kafka.Message, workers)
+
+	var wg sync.WaitGroup
+
+	for i := range queues {
+		queues[i] = make(chan *kafka.Message, workerQueueSize)
+
+		wg.Add(1)
+
+		go func(worker int, queue <-chan *kafka.Message) {
+			defer wg.Done()
+			c.work(ctx, source, worker, queue)
+		}(i+1, queues[i])
+	}
+
+	defer func() {
+		c.stopping.Store(true)
+
+		for _, queue := range queues {
+			close(queue)
+		}
+
+		wg.Wait()
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -61,9 +167,10 @@ func (c *Consumer) Start(ctx context.Context) {
 
 			return
 		default:
-			kafkaMsg, err := c.Consumer.ReadMessage(readTimeout)
+			kafkaMsg, err := source.ReadMessage(readTimeout)
 			if err != nil {
-				if err.(kafka.Error).Code() == kafka.ErrTimedOut {
+				var kafkaErr kafka.Error
+				if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut {
 					continue
 				}
 				log.Printf("error reading message from kafka: %v", err)
@@ -74,26 +181,280 @@ func (c *Consumer) Start(ctx context.Context) {
 				continue
 			}
 
-			// Обработка сообщения
-			if err = c.Handler.HandleMessage(kafkaMsg.Value, kafkaMsg.TopicPartition, c.consumerNumber); err != nil {
-				log.Printf("error handle message: %v", err)
+			c.offsets.add(kafkaMsg.TopicPartition)
 
-				continue
+			select {
+			case queues[workerFor(kafkaMsg, workers)] <- kafkaMsg:
+			case <-ctx.Done():
+				log.Println("Stopping Kafka consumer...")
+
+				return
 			}
+		}
+	}
+}
 
-			// Фиксация смещения сообщения
-			if _, err = c.Consumer.StoreMessage(kafkaMsg); err != nil {
-				log.Printf("error store message: %v", err)
+// Обрабатывает сообщения из очереди и сохраняет смещения обработанных сообщений.
+func (c *Consumer) work(ctx context.Context, source messageSource, worker int, queue <-chan *kafka.Message) {
+	for kafkaMsg := range queue {
+		// После остановки оставшиеся сообщения будут прочитаны снова после перезапуска
+		if ctx.Err() != nil {
+			continue
+		}
 
-				continue
+		// Обработка сообщения, при неудаче - отправка в DLQ
+		if err := c.process(ctx, kafkaMsg, worker); err != nil {
+			// Смещение не сохраняется, сообщение будет прочитано снова после перезапуска
+			log.Printf("error process message: %v", err)
+
+			continue
+		}
+
+		// Фиксация смещения партиции
+		c.offsets.complete(kafkaMsg.TopicPartition, func(tp kafka.TopicPartition) {
+			if _, err := source.StoreOffsets([]kafka.TopicPartition{tp}); err != nil {
+				log.Printf("error store offset %s: %v", tp, err)
+			}
+		})
+	}
+}
+
+// Номер очереди обработчика для сообщения: по ключу, а без ключа - по партиции.
+func workerFor(msg *kafka.Message, workers int) int {
+	h := fnv.New32a()
+
+	if len(msg.Key) > 0 {
+		_, _ = h.Write(msg.Key)
+	} else {
+		_, _ = h.Write([]byte(strconv.Itoa(int(msg.TopicPartition.Partition))))
+	}
+
+	return int(h.Sum32() % uint32(workers))
+}
+
+// При отзыве партиций дожидается обработки прочитанных из них сообщений
+// и фиксирует смещения, чтобы новый владелец не обрабатывал их повторно.
+func (c *Consumer) rebalance(consumer *kafka.Consumer, event kafka.Event) error {
+	switch e := event.(type) {
+	case kafka.AssignedPartitions:
+		log.Printf("Assigned partitions: %v", e.Partitions)
+	case kafka.RevokedPartitions:
+		log.Printf("Revoking partitions: %v", e.Partitions)
+		c.revoke(e.Partitions)
+
+		if err := commit(consumer); err != nil {
+			log.Printf("error commit offsets: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Дожидается обработки сообщений отзываемых партиций и забывает их. При
+// остановке сообщения из очередей не обрабатываются и будут прочитаны снова
+// после перезапуска, поэтому ожидать их нет смысла.
+func (c *Consumer) revoke(partitions []kafka.TopicPartition) {
+	if c.stopping.Load() {
+		if n := c.offsets.inFlight(partitions); n > 0 {
+			log.Printf("Consumer is stopping, %d unprocessed messages of revoked partitions will be read again", n)
+		}
+	} else if !c.offsets.wait(partitions, drainTimeout) {
+		log.Printf("Messages of revoked partitions were not processed in %s", drainTimeout)
+	}
+
+	c.offsets.remove(partitions)
+}
+
+// Синхронно фиксирует сохраненные смещения. Отсутствие новых смещений не считается ошибкой.
+func commit(consumer *kafka.Consumer) error {
+	_, err := consumer.Commit()
+
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrNoOffset {
+		return nil
+	}
+
+	return err
+}
+
+// Обрабатывает сообщение с повторами временных ошибок. Если обработать
+// сообщение не удалось, оно отправляется в DLQ. Ошибка возвращается, только
+// если сообщение не обработано и не попало в DLQ до отмены контекста.
+func (c *Consumer) Process(ctx context.Context, msg *kafka.Message) error {
+	return c.process(ctx, msg, 1)
+}
+
+func (c *Consumer) process(ctx context.Context, msg *kafka.Message, worker int) error {
+	attempts, err := c.handleWithRetry(ctx, msg, worker)
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	log.Printf("Message %s failed after %d attempts, sending to dead letter topic: %v", msg.TopicPartition, attempts, err)
+
+	return c.sendToDeadLetter(ctx, msg, attempts, err)
+}
+
+func (c *Consumer) handleWithRetry(ctx context.Context, msg *kafka.Message, worker int) (int, error) {
+	maxAttempts := max(c.Retry.MaxAttempts, 1)
+
+	var err error
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			delay := c.Retry.Backoff(attempt)
+			log.Printf("Retrying message %s in %s (attempt %d/%d): %v", msg.TopicPartition, delay, attempt, maxAttempts, err)
+
+			if !sleep(ctx, delay) {
+				return attempt - 1, err
 			}
 		}
+
+		if err = c.handle(msg, worker); err == nil || IsPermanent(err) {
+			return attempt, err
+		}
 	}
+
+	return maxAttempts, err
 }
 
-// Закрывает consumer.
-func (c *Consumer) Close() error {
+func (c *Consumer) handle(msg *kafka.Message, worker int) error {
+	if msg.Value != nil {
+		return c.Handler.HandleMessage(msg.Value, msg.TopicPartition, worker)
+	}
+
+	if h, ok := c.Handler.(TombstoneHandler); ok && len(msg.Key) > 0 {
+		return h.HandleTombstone(msg.Key, msg.TopicPartition)
+	}
+
+	return nil
+}
+
+// Отправляет сообщение в <topic>.dlq, повторяя отправку до успеха или отмены контекста,
+// чтобы сообщение не было потеряно.
+func (c *Consumer) sendToDeadLetter(ctx context.Context, msg *kafka.Message, attempts int, cause error) error {
+	topic := *msg.TopicPartition.Topic
+
+	reason := "exhausted"
+	if IsPermanent(cause) {
+		reason = "permanent"
+	}
+
+	if c.DeadLetter == nil {
+		log.Printf("Dead letter producer is not configured, dropping message %s", msg.TopicPartition)
+		monitoring.KafkaDeadLetterMessagesTotal.WithLabelValues(topic, reason).Inc()
+
+		return nil
+	}
+
+	dlqMsg := deadLetterMessage(msg, attempts, cause)
+
+	for attempt := 1; ; attempt++ {
+		err := c.DeadLetter.ProduceMessageSync(dlqMsg)
+		if err == nil {
+			monitoring.KafkaDeadLetterMessagesTotal.WithLabelValues(topic, reason).Inc()
+
+			return nil
+		}
+
+		log.Printf("Failed to send message to %s: %v", dlqMsg.Topic, err)
+
+		if !sleep(ctx, c.Retry.Backoff(attempt+1)) {
+			return errors.Join(ctx.Err(), err)
+		}
+	}
+}
+
+// Сообщение для DLQ: исходные ключ, значение и заголовки и сведения об ошибке.
+func deadLetterMessage(msg *kafka.Message, attempts int, cause error) Message {
+	headers := make(map[string]string, len(msg.Headers)+7)
+	for _, header := range msg.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+
+	headers[HeaderDLQError] = cause.Error()
+	headers[HeaderDLQPermanent] = strconv.FormatBool(IsPermanent(cause))
+	headers[HeaderDLQAttempts] = strconv.Itoa(attempts)
+	headers[HeaderDLQTopic] = *msg.TopicPartition.Topic
+	headers[HeaderDLQPartition] = strconv.Itoa(int(msg.TopicPartition.Partition))
+	headers[HeaderDLQOffset] = msg.TopicPartition.Offset.String()
+	headers[HeaderDLQFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	return Message{
+		Topic:   *msg.TopicPartition.Topic + deadLetterSuffix,
+		Key:     string(msg.Key),
+		Value:   msg.Value,
+		Headers: headers,
+	}
+}
+
+// Ждет указанное время, возвращает false, если контекст отменен раньше.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Запрашивает метаданные кластера, используется проверкой готовности.
+// После Close возвращает ErrConsumerClosed, не обращаясь к клиенту kafka.
+func (c *Consumer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed.Load() {
+		return nil, ErrConsumerClosed
+	}
+
+	return c.Consumer.GetMetadata(topic, allTopics, timeoutMs)
+}
+
+// Фиксирует смещения обработанных сообщений и закрывает consumer.
+// Вызывается после завершения Start. Consumer становится недоступен сразу,
+// а если закрытие не завершилось до отмены ctx, оно продолжается в фоне
+// и Close возвращает ошибку.
+func (c *Consumer) Close(ctx context.Context) error {
+	if c.closed.Swap(true) {
+		return ErrConsumerClosed
+	}
+
 	log.Println("Closing Kafka consumer connection...")
 
-	return c.Consumer.Close()
+	c.stopping.Store(true)
+
+	done := make(chan error, 1)
+
+	go func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if err := commit(c.Consumer); err != nil {
+			log.Printf("error commit offsets: %v", err)
+		}
+
+		err := c.Consumer.Close()
+		if ctx.Err() != nil {
+			log.Printf("Abandoned Kafka consumer close finished: %v", err)
+		}
+
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		log.Println("Kafka consumer did not close in time, abandoning close")
+
+		return fmt.Errorf("kafka consumer did not close in time: %w", ctx.Err())
+	}
 }
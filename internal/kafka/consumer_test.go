@@ -0,0 +1,129 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/kafka"
+	"Go-internship-Manifure/internal/retry"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+// Обработчик, который возвращает ошибки из списка, а затем успешно обрабатывает сообщение.
+type flakyHandler struct {
+	errs  []error
+	calls int
+}
+
+func (h *flakyHandler) HandleMessage(_ []byte, _ confluent.TopicPartition, _ int) error {
+	h.calls++
+
+	if h.calls <= len(h.errs) {
+		return h.errs[h.calls-1]
+	}
+
+	return nil
+}
+
+func testMessage() *confluent.Message {
+	topic := "product-updates"
+
+	return &confluent.Message{
+		TopicPartition: confluent.TopicPartition{Topic: &topic, Partition: 2, Offset: 42},
+		Key:            []byte("product-1"),
+		Value:          []byte(`{"type":"product.updated"}`),
+		Headers:        []confluent.Header{{Key: "event_type", Value: []byte("product.updated")}},
+	}
+}
+
+func TestConsumerProcess(t *testing.T) {
+	transient := errors.New("database unavailable")
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantDLQ   bool
+		permanent string
+	}{
+		{"success after retries", []error{transient, transient}, 3, false, ""},
+		{"permanent error", []error{kafka.Permanent(errors.New("invalid json"))}, 1, true, "true"},
+		{"retries exhausted", []error{transient, transient, transient, transient}, 3, true, "false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &flakyHandler{errs: tt.errs}
+			deadLetter := kafka.NewMemoryProducer(1)
+
+			consumer := &kafka.Consumer{
+				Handler:    handler,
+				Retry:      retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+				DeadLetter: deadLetter,
+			}
+
+			require.NoError(t, consumer.Process(context.Background(), testMessage()))
+			require.Equal(t, tt.wantCalls, handler.calls)
+
+			if !tt.wantDLQ {
+				require.Empty(t, deadLetter.Messages)
+
+				return
+			}
+
+			require.Len(t, deadLetter.Messages, 1)
+
+			// В DLQ попадают исходные ключ, значение и заголовки и сведения об ошибке
+			msg := deadLetter.Messages[0]
+			require.Equal(t, "product-updates.dlq", msg.Topic)
+			require.Equal(t, "product-1", msg.Key)
+			require.Equal(t, `{"type":"product.updated"}`, string(msg.Value))
+			require.Equal(t, "product.updated", msg.Headers["event_type"])
+			require.Equal(t, tt.permanent, msg.Headers[kafka.HeaderDLQPermanent])
+			require.Equal(t, "product-updates", msg.Headers[kafka.HeaderDLQTopic])
+			require.Equal(t, "2", msg.Headers[kafka.HeaderDLQPartition])
+			require.Equal(t, "42", msg.Headers[kafka.HeaderDLQOffset])
+			require.NotEmpty(t, msg.Headers[kafka.HeaderDLQError])
+		})
+	}
+}
+
+func TestConsumerProcessKeepsMessageWhenDeadLetterFails(t *testing.T) {
+	deadLetter := kafka.NewMemoryProducer(1)
+	deadLetter.Err = errors.New("broker unavailable")
+
+	consumer := &kafka.Consumer{
+		Handler:    &flakyHandler{errs: []error{kafka.Permanent(errors.New("invalid json"))}},
+		Retry:      retry.Policy{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		DeadLetter: deadLetter,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// Пока сообщение не попало в DLQ, смещение сохранять нельзя
+	require.ErrorIs(t, consumer.Process(ctx, testMessage()), context.DeadlineExceeded)
+}
+
+func TestConsumerMetadataAfterClose(t *testing.T) {
+	cluster, err := confluent.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	consumer, err := kafka.NewConsumer(&flakyHandler{}, []string{cluster.BootstrapServers()}, []string{"events"}, "test", 1)
+	require.NoError(t, err)
+
+	metadata, err := consumer.GetMetadata(nil, false, 5000)
+	require.NoError(t, err)
+	require.NotEmpty(t, metadata.Brokers)
+
+	require.NoError(t, consumer.Close(context.Background()))
+
+	// Проверка готовности во время остановки не обращается к закрытому клиенту
+	_, err = consumer.GetMetadata(nil, false, 5000)
+	require.ErrorIs(t, err, kafka.ErrConsumerClosed)
+	require.ErrorIs(t, consumer.Close(context.Background()), kafka.ErrConsumerClosed)
+}
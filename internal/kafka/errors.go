@@ -0,0 +1,25 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Признак ошибки, которую бессмысленно повторять: некорректный JSON,
+// непрошедшая валидация, неподдерживаемая версия схемы.
+var ErrPermanent = errors.New("permanent error")
+
+// Помечает ошибку обработки сообщения как постоянную, такое сообщение
+// сразу отправляется в DLQ без повторов.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// Проверяет, является ли ошибка постоянной.
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrPermanent)
+}
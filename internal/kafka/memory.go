@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const defaultMemoryPartitions = 3
+
+// Сообщение, записанное продюсером в памяти.
+type ProducedMessage struct {
+	Message
+	Partition int32
+}
+
+// Продюсер в памяти для тестов: запоминает ключи, заголовки и партиции сообщений.
+// Партиция выбирается по хэшу ключа, поэтому сообщения с одним ключом
+// всегда попадают в одну партицию, как и в kafka.
+type MemoryProducer struct {
+	Partitions int32
+	Messages   []ProducedMessage
+	Err        error
+	mu         sync.Mutex
+	next       int32
+}
+
+// Создает продюсер в памяти с указанным числом партиций.
+func NewMemoryProducer(partitions int32) *MemoryProducer {
+	return &MemoryProducer{Partitions: partitions}
+}
+
+func (m *MemoryProducer) Produce(msg string) error {
+	return m.ProduceMessage(Message{Value: []byte(msg)})
+}
+
+func (m *MemoryProducer) ProduceSync(msg string) error {
+	return m.ProduceMessage(Message{Value: []byte(msg)})
+}
+
+func (m *MemoryProducer) ProduceMessageSync(msg Message) error {
+	return m.ProduceMessage(msg)
+}
+
+func (m *MemoryProducer) ProduceMessages(msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = m.ProduceMessage(msg)
+	}
+
+	return errs
+}
+
+func (m *MemoryProducer) ProduceMessage(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+
+	m.Messages = append(m.Messages, ProducedMessage{Message: msg, Partition: m.partition(msg.Key)})
+
+	return nil
+}
+
+// Значения отправленных сообщений, кроме tombstone.
+func (m *MemoryProducer) Values() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var values []string
+
+	for _, msg := range m.Messages {
+		if msg.Value != nil {
+			values = append(values, string(msg.Value))
+		}
+	}
+
+	return values
+}
+
+// Ключи отправленных tombstone.
+func (m *MemoryProducer) Tombstones() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+
+	for _, msg := range m.Messages {
+		if msg.Value == nil {
+			keys = append(keys, msg.Key)
+		}
+	}
+
+	return keys
+}
+
+// Сообщения без ключа распределяются по кругу.
+func (m *MemoryProducer) partition(key string) int32 {
+	partitions := m.Partitions
+	if partitions <= 0 {
+		partitions = defaultMemoryPartitions
+	}
+
+	if key == "" {
+		m.next = (m.next + 1) % partitions
+
+		return m.next
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int32(h.Sum32() % uint32(partitions))
+}
@@ -0,0 +1,142 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+func keyOf(tp kafka.TopicPartition) partitionKey {
+	var topic string
+	if tp.Topic != nil {
+		topic = *tp.Topic
+	}
+
+	return partitionKey{topic: topic, partition: tp.Partition}
+}
+
+// Сообщения партиции, которые прочитаны, но еще не могут быть зафиксированы.
+type partitionOffsets struct {
+	pending []kafka.Offset // В порядке чтения
+	done    map[kafka.Offset]bool
+}
+
+// Учитывает сообщения, которые обрабатываются параллельно, и определяет
+// смещение, до которого все сообщения партиции успешно обработаны.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+	changed    chan struct{} // Закрывается при каждом завершении обработки
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[partitionKey]*partitionOffsets),
+		changed:    make(chan struct{}),
+	}
+}
+
+// Регистрирует прочитанное сообщение.
+func (t *offsetTracker) add(tp kafka.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := keyOf(tp)
+
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &partitionOffsets{done: make(map[kafka.Offset]bool)}
+		t.partitions[key] = p
+	}
+
+	p.pending = append(p.pending, tp.Offset)
+}
+
+// Отмечает сообщение обработанным. Если все более ранние сообщения партиции
+// тоже обработаны, вызывает store со смещением для фиксации. store вызывается
+// под блокировкой, чтобы смещения партиции сохранялись по возрастанию.
+func (t *offsetTracker) complete(tp kafka.TopicPartition, store func(kafka.TopicPartition)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	defer t.notify()
+
+	p, ok := t.partitions[keyOf(tp)]
+	if !ok {
+		// Партиция отозвана, смещение фиксирует новый владелец
+		return
+	}
+
+	p.done[tp.Offset] = true
+
+	advanced := false
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		delete(p.done, p.pending[0])
+		tp.Offset = p.pending[0] + 1
+		advanced = true
+		p.pending = p.pending[1:]
+	}
+
+	if advanced {
+		store(tp)
+	}
+}
+
+// Число необработанных сообщений в указанных партициях.
+func (t *offsetTracker) inFlight(partitions []kafka.TopicPartition) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, tp := range partitions {
+		if p, ok := t.partitions[keyOf(tp)]; ok {
+			n += len(p.pending)
+		}
+	}
+
+	return n
+}
+
+// Ждет завершения обработки сообщений указанных партиций. Возвращает false,
+// если за отведенное время обработка не завершилась.
+func (t *offsetTracker) wait(partitions []kafka.TopicPartition, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		t.mu.Lock()
+		changed := t.changed
+		t.mu.Unlock()
+
+		if t.inFlight(partitions) == 0 {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// Удаляет состояние отозванных партиций.
+func (t *offsetTracker) remove(partitions []kafka.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tp := range partitions {
+		delete(t.partitions, keyOf(tp))
+	}
+}
+
+func (t *offsetTracker) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
@@ -0,0 +1,234 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+func partition(topic string, p int32, offset kafka.Offset) kafka.TopicPartition {
+	return kafka.TopicPartition{Topic: &topic, Partition: p, Offset: offset}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tracker := newOffsetTracker()
+
+	var stored []kafka.TopicPartition
+
+	store := func(tp kafka.TopicPartition) { stored = append(stored, tp) }
+
+	for offset := kafka.Offset(10); offset < 13; offset++ {
+		tracker.add(partition("product-updates", 0, offset))
+	}
+
+	tracker.add(partition("product-updates", 1, 5))
+
+	// Более раннее сообщение партиции еще обрабатывается
+	tracker.complete(partition("product-updates", 0, 11), store)
+	require.Empty(t, stored)
+
+	tracker.complete(partition("product-updates", 1, 5), store)
+	tracker.complete(partition("product-updates", 0, 10), store)
+	require.Equal(t, []kafka.TopicPartition{
+		partition("product-updates", 1, 6),
+		partition("product-updates", 0, 12),
+	}, stored)
+
+	revoked := []kafka.TopicPartition{partition("product-updates", 0, kafka.OffsetInvalid)}
+	require.Equal(t, 1, tracker.inFlight(revoked))
+	require.False(t, tracker.wait(revoked, 10*time.Millisecond))
+
+	go tracker.complete(partition("product-updates", 0, 12), func(kafka.TopicPartition) {})
+
+	require.True(t, tracker.wait(revoked, time.Second))
+
+	// После отзыва партиции смещение не фиксируется
+	tracker.add(partition("product-updates", 0, 13))
+	tracker.remove(revoked)
+
+	stored = nil
+	tracker.complete(partition("product-updates", 0, 13), store)
+	require.Empty(t, stored)
+}
+
+// Источник, который отдает сообщения из списка и запоминает сохраненные смещения.
+type fakeSource struct {
+	mu       sync.Mutex
+	messages []*kafka.Message
+	stored   map[int32][]kafka.Offset
+}
+
+func (s *fakeSource) ReadMessage(_ time.Duration) (*kafka.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.messages) == 0 {
+		return nil, kafka.NewError(kafka.ErrTimedOut, "timed out", false)
+	}
+
+	msg := s.messages[0]
+	s.messages = s.messages[1:]
+
+	return msg, nil
+}
+
+func (s *fakeSource) StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tp := range offsets {
+		s.stored[tp.Partition] = append(s.stored[tp.Partition], tp.Offset)
+	}
+
+	return offsets, nil
+}
+
+func (s *fakeSource) last(p int32) kafka.Offset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.stored[p]
+	if len(stored) == 0 {
+		return kafka.OffsetInvalid
+	}
+
+	return stored[len(stored)-1]
+}
+
+// Запоминает порядок обработки сообщений по ключам.
+type orderHandler struct {
+	mu      sync.Mutex
+	byKey   map[string][]kafka.Offset
+	workers map[string][]int
+}
+
+func (h *orderHandler) HandleMessage(message []byte, tp kafka.TopicPartition, cn int) error {
+	// Первые сообщения обрабатываются дольше, чтобы порядок завершения отличался от порядка чтения
+	if tp.Offset < 4 {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := string(message)
+	h.byKey[key] = append(h.byKey[key], tp.Offset)
+
+	h.workers[key] = append(h.workers[key], cn)
+
+	return nil
+}
+
+func TestConsumerRunPreservesKeyOrder(t *testing.T) {
+	source := &fakeSource{stored: make(map[int32][]kafka.Offset)}
+
+	const perPartition = 20
+
+	for offset := kafka.Offset(0); offset < perPartition; offset++ {
+		for p := int32(0); p < 2; p++ {
+			key := fmt.Sprintf("key-%d-%d", p, offset%3)
+			source.messages = append(source.messages, &kafka.Message{
+				TopicPartition: partition("product-updates", p, offset),
+				Key:            []byte(key),
+				Value:          []byte(key),
+			})
+		}
+	}
+
+	handler := &orderHandler{byKey: make(map[string][]kafka.Offset), workers: make(map[string][]int)}
+	consumer := &Consumer{Handler: handler, Retry: DefaultRetryPolicy(), workers: 4}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		consumer.run(ctx, source)
+	}()
+
+	require.Eventually(t, func() bool {
+		return source.last(0) == perPartition && source.last(1) == perPartition
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	for key, offsets := range handler.byKey {
+		require.IsIncreasing(t, offsets, key)
+	}
+
+	// Сообщения с одним ключом обрабатывает один обработчик
+	for key, workers := range handler.workers {
+		for _, worker := range workers {
+			require.Equal(t, workers[0], worker, key)
+		}
+	}
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+
+	for p, stored := range source.stored {
+		require.IsIncreasing(t, stored, "partition %d", p)
+	}
+}
+
+// Обработчик, который не завершает обработку до отмены контекста.
+type blockingHandler struct {
+	started chan struct{}
+	once    sync.Once
+	ctx     context.Context
+}
+
+func (h *blockingHandler) HandleMessage([]byte, kafka.TopicPartition, int) error {
+	h.once.Do(func() { close(h.started) })
+	<-h.ctx.Done()
+
+	return h.ctx.Err()
+}
+
+func TestConsumerStopDoesNotWaitForQueuedMessages(t *testing.T) {
+	source := &fakeSource{stored: make(map[int32][]kafka.Offset)}
+
+	for offset := kafka.Offset(0); offset < 10; offset++ {
+		source.messages = append(source.messages, &kafka.Message{
+			TopicPartition: partition("product-updates", 0, offset),
+			Value:          []byte("event"),
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := &blockingHandler{started: make(chan struct{}), ctx: ctx}
+	consumer := &Consumer{Handler: handler, Retry: DefaultRetryPolicy(), workers: 1}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		consumer.run(ctx, source)
+	}()
+
+	// Первое сообщение обрабатывается, остальные ждут в очереди обработчика
+	<-handler.started
+	require.Eventually(t, func() bool {
+		return consumer.offsets.inFlight([]kafka.TopicPartition{partition("product-updates", 0, 0)}) == 10
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	// Отзыв партиций при закрытии consumer не ждет необработанных сообщений
+	started := time.Now()
+	consumer.revoke([]kafka.TopicPartition{partition("product-updates", 0, kafka.OffsetInvalid)})
+
+	require.Less(t, time.Since(started), time.Second)
+	require.Zero(t, consumer.offsets.inFlight([]kafka.TopicPartition{partition("product-updates", 0, 0)}))
+	require.Empty(t, source.stored)
+}
@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"Go-internship-Manifure/internal/model"
+	"Go-internship-Manifure/internal/monitoring"
+)
+
+const (
+	outboxBatchSize    = 100
+	outboxPollInterval = time.Second
+	outboxMaxBackoff   = 30 * time.Second
+)
+
+// Хранилище outbox, из которого читает relay.
+type OutboxStore interface {
+	// ClaimRelay захватывает право на отправку, false означает, что outbox
+	// отправляет другая реплика. ReleaseRelay возвращает это право.
+	ClaimRelay(ctx context.Context) (bool, error)
+	ReleaseRelay()
+	PendingMessages(limit int) ([]model.OutboxMessage, error)
+	MarkSent(id uint64) error
+	MarkFailed(id uint64, cause error) error
+	OldestPending() (time.Time, bool, error)
+}
+
+// Фоновый процесс, который отправляет сообщения outbox в kafka. Сообщения
+// отправляются строго по порядку: при ошибке отправка останавливается
+// и повторяется с экспоненциальной задержкой. Relay запускается в каждой
+// реплике, но отправляет только тот, что захватил outbox.
+type OutboxRelay struct {
+	name     string
+	store    OutboxStore
+	producer ProducerInterface
+	claimed  bool
+
+	pollInterval time.Duration
+	maxBackoff   time.Duration
+}
+
+// Создает relay, name используется в метриках.
+func NewOutboxRelay(name string, store OutboxStore, producer ProducerInterface) *OutboxRelay {
+	return &OutboxRelay{
+		name:         name,
+		store:        store,
+		producer:     producer,
+		pollInterval: outboxPollInterval,
+		maxBackoff:   outboxMaxBackoff,
+	}
+}
+
+// Запускает отправку до отмены контекста.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	log.Printf("Starting outbox relay %s...", r.name)
+
+	backoff := r.pollInterval
+
+	defer r.store.ReleaseRelay()
+
+	for {
+		sent, err := r.relayIfClaimed(ctx)
+
+		wait := r.pollInterval
+
+		switch {
+		case err != nil:
+			log.Printf("Outbox relay %s failed, retrying in %s: %v", r.name, backoff, err)
+
+			wait = backoff
+			backoff = min(backoff*2, r.maxBackoff)
+		case sent == outboxBatchSize:
+			// Очередь не разобрана, следующая пачка отправляется сразу
+			wait = 0
+			backoff = r.pollInterval
+		default:
+			backoff = r.pollInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Stopping outbox relay %s...", r.name)
+
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Отправляет пачку, если outbox захвачен этим relay.
+func (r *OutboxRelay) relayIfClaimed(ctx context.Context) (int, error) {
+	claimed, err := r.store.ClaimRelay(ctx)
+
+	if claimed != r.claimed {
+		r.claimed = claimed
+
+		if claimed {
+			log.Printf("Outbox relay %s claimed the outbox", r.name)
+		} else {
+			log.Printf("Outbox relay %s released the outbox", r.name)
+		}
+	}
+
+	if err != nil || !claimed {
+		return 0, err
+	}
+
+	return r.RelayOnce()
+}
+
+// Отправляет одну пачку неотправленных сообщений, возвращает число отправленных.
+func (r *OutboxRelay) RelayOnce() (int, error) {
+	defer r.updateLag()
+
+	messages, err := r.store.PendingMessages(outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// Пачка отправляется асинхронно, сообщения отмечаются после подтверждения брокера
+	errs := r.publish(messages)
+
+	for i, message := range messages {
+		if err := errs[i]; err != nil {
+			// Следующие сообщения могли быть доставлены, но будут отправлены повторно,
+			// чтобы сообщения одного outbox отмечались строго по порядку
+			if markErr := r.store.MarkFailed(message.ID, err); markErr != nil {
+				log.Printf("Failed to record outbox failure: %v", markErr)
+			}
+
+			return i, fmt.Errorf("failed to publish outbox message %d: %w", message.ID, err)
+		}
+
+		// Если отметка не сохранится, сообщение будет отправлено повторно:
+		// потребители должны быть идемпотентными
+		if err := r.store.MarkSent(message.ID); err != nil {
+			return i, err
+		}
+	}
+
+	return len(messages), nil
+}
+
+func (r *OutboxRelay) publish(messages []model.OutboxMessage) []error {
+	msgs := make([]Message, len(messages))
+
+	for i, message := range messages {
+		msgs[i] = Message{Key: message.Key, Headers: message.Headers}
+		if !message.IsTombstone() {
+			msgs[i].Value = message.Payload
+		}
+	}
+
+	return r.producer.ProduceMessages(msgs)
+}
+
+// Обновляет метрику возраста самого старого неотправленного сообщения.
+func (r *OutboxRelay) updateLag() {
+	oldest, ok, err := r.store.OldestPending()
+	if err != nil {
+		log.Printf("Failed to get outbox lag: %v", err)
+
+		return
+	}
+
+	lag := 0.0
+	if ok {
+		lag = time.Since(oldest).Seconds()
+	}
+
+	monitoring.OutboxLagSeconds.WithLabelValues(r.name).Set(lag)
+}
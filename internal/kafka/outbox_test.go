@@ -0,0 +1,149 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	outbox "Go-internship-Manifure/internal/db/outbox_db"
+	"Go-internship-Manifure/internal/kafka"
+	"Go-internship-Manifure/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxRelayRetriesInOrder(t *testing.T) {
+	store := outbox.NewMemoryOutbox()
+	store.Enqueue(
+		model.OutboxMessage{Key: "1", Payload: []byte("first")},
+		model.OutboxMessage{Key: "1"},
+		model.OutboxMessage{Key: "2", Payload: []byte("second")},
+	)
+
+	producer := kafka.NewMemoryProducer(3)
+	producer.Err = errors.New("broker unavailable")
+	relay := kafka.NewOutboxRelay("test", store, producer)
+
+	// При ошибке сообщения остаются в outbox
+	sent, err := relay.RelayOnce()
+	require.Error(t, err)
+	require.Zero(t, sent)
+
+	pending, err := store.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	require.Equal(t, 1, pending[0].Attempts)
+	require.Equal(t, "broker unavailable", pending[0].LastError)
+
+	producer.Err = nil
+
+	sent, err = relay.RelayOnce()
+	require.NoError(t, err)
+	require.Equal(t, 3, sent)
+	require.Equal(t, []string{"first", "second"}, producer.Values())
+	require.Equal(t, []string{"1"}, producer.Tombstones())
+
+	// Сообщения с одним ключом записаны в одну партицию
+	require.Equal(t, producer.Messages[0].Partition, producer.Messages[1].Partition)
+
+	pending, err = store.PendingMessages(10)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+// Продюсер, который не доставляет сообщения с ключом failKey.
+type partialProducer struct {
+	*kafka.MemoryProducer
+	failKey string
+}
+
+func (p *partialProducer) ProduceMessages(msgs []kafka.Message) []error {
+	errs := make([]error, len(msgs))
+
+	for i, msg := range msgs {
+		if msg.Key == p.failKey {
+			errs[i] = errors.New("message timed out")
+
+			continue
+		}
+
+		errs[i] = p.ProduceMessage(msg)
+	}
+
+	return errs
+}
+
+func TestOutboxRelayMarksBatchInOrder(t *testing.T) {
+	store := outbox.NewMemoryOutbox()
+	store.Enqueue(
+		model.OutboxMessage{Key: "1", Payload: []byte("first")},
+		model.OutboxMessage{Key: "2", Payload: []byte("second")},
+		model.OutboxMessage{Key: "3", Payload: []byte("third")},
+		model.OutboxMessage{Key: "4", Payload: []byte("fourth")},
+	)
+
+	producer := &partialProducer{MemoryProducer: kafka.NewMemoryProducer(3), failKey: "3"}
+	relay := kafka.NewOutboxRelay("test", store, producer)
+
+	// Пачка отправляется целиком, отмечаются сообщения до первого недоставленного
+	sent, err := relay.RelayOnce()
+	require.Error(t, err)
+	require.Equal(t, 2, sent)
+	require.Equal(t, []string{"first", "second", "fourth"}, producer.Values())
+
+	pending, err := store.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, "3", pending[0].Key)
+	require.Equal(t, "message timed out", pending[0].LastError)
+
+	// Доставленное после ошибки сообщение отправляется повторно
+	producer.failKey = ""
+
+	sent, err = relay.RelayOnce()
+	require.NoError(t, err)
+	require.Equal(t, 2, sent)
+	require.Equal(t, []string{"first", "second", "fourth", "third", "fourth"}, producer.Values())
+}
+
+// Outbox, право на отправку которого может держать другая реплика.
+type claimOutbox struct {
+	*outbox.MemoryOutbox
+	claimed  bool
+	released bool
+}
+
+func (o *claimOutbox) ClaimRelay(context.Context) (bool, error) {
+	return o.claimed, nil
+}
+
+func (o *claimOutbox) ReleaseRelay() {
+	o.released = true
+}
+
+func TestOutboxRelaySendsOnlyWhenClaimed(t *testing.T) {
+	for _, claimed := range []bool{false, true} {
+		store := &claimOutbox{MemoryOutbox: outbox.NewMemoryOutbox(), claimed: claimed}
+		store.Enqueue(model.OutboxMessage{Key: "1", Payload: []byte("first")})
+
+		producer := kafka.NewMemoryProducer(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		kafka.NewOutboxRelay("test", store, producer).Run(ctx)
+		cancel()
+
+		pending, err := store.PendingMessages(10)
+		require.NoError(t, err)
+
+		if claimed {
+			require.Equal(t, []string{"first"}, producer.Values())
+			require.Empty(t, pending)
+		} else {
+			// Outbox отправляет другая реплика
+			require.Empty(t, producer.Values())
+			require.Len(t, pending, 1)
+		}
+
+		require.True(t, store.released)
+	}
+}
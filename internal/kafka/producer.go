@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"Go-internship-Manifure/internal/monitoring"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
@@ -14,21 +17,71 @@ const (
 	flushTimeout = 5000 // ms
 )
 
-var errUnknownType = errors.New("unknown event type")
+var ErrProducerClosed = errors.New("producer is closed")
 
 type ProducerInterface interface {
 	Produce(msg string) error
+	ProduceSync(msg string) error
+	ProduceMessage(msg Message) error
+	ProduceMessageSync(msg Message) error
+	ProduceMessages(msgs []Message) []error
+}
+
+// Сообщение с ключом и заголовками. Сообщения с одним ключом попадают в одну
+// партицию, поэтому ключом служит id сущности. Value == nil означает tombstone.
+type Message struct {
+	Topic   string // Если не задан, используется топик продюсера
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Настройки продюсера.
+type ProducerConfig struct {
+	Async       bool          // Produce не ждет подтверждения брокера
+	Linger      time.Duration // Время накопления пачки перед отправкой
+	BatchSize   int           // Максимальный размер пачки в байтах
+	Compression string        // none, gzip, snappy, lz4 или zstd
+	Idempotence bool          // Исключает дубликаты и переупорядочивание при повторах
+
+	DeliveryTimeout time.Duration // Срок доставки сообщения с учетом повторов, после него приходит отчет об ошибке
+}
+
+// Настройки по умолчанию: асинхронная отправка небольшими пачками со сжатием.
+func DefaultProducerConfig() ProducerConfig {
+	return ProducerConfig{
+		Async:       true,
+		Linger:      5 * time.Millisecond,
+		BatchSize:   1 << 20,
+		Compression: "lz4",
+		Idempotence: true,
+
+		DeliveryTimeout: 30 * time.Second,
+	}
 }
 
 type Producer struct {
 	Producer *kafka.Producer
 	Topic    string
+
+	async bool
+	done  chan struct{} // Закрывается, когда обработчик отчетов о доставке завершен
+	once  sync.Once
 }
 
 // Подключается к kafka и создает новый producer.
-func NewProducer(addrs []string, topic string) (*Producer, error) {
+func NewProducer(addrs []string, topic string, cfg ProducerConfig) (*Producer, error) {
 	conf := &kafka.ConfigMap{
-		"bootstrap.servers": strings.Join(addrs, ","),
+		"bootstrap.servers":  strings.Join(addrs, ","),
+		"linger.ms":          int(cfg.Linger.Milliseconds()),
+		"batch.size":         cfg.BatchSize,
+		"compression.type":   cfg.Compression,
+		"enable.idempotence": cfg.Idempotence,
+		"partitioner":        "murmur2_random", // Совместим с Java клиентами, сообщения без ключа распределяются случайно
+	}
+
+	if cfg.DeliveryTimeout > 0 {
+		_ = conf.SetKey("delivery.timeout.ms", int(cfg.DeliveryTimeout.Milliseconds()))
 	}
 
 	p, err := kafka.NewProducer(conf)
@@ -36,47 +89,179 @@ func NewProducer(addrs []string, topic string) (*Producer, error) {
 		return nil, fmt.Errorf("error creating new producer: %w", err)
 	}
 
-	return &Producer{
+	producer := &Producer{
 		Producer: p,
 		Topic:    topic,
-	}, nil
+		async:    cfg.Async,
+		done:     make(chan struct{}),
+	}
+
+	go producer.handleDeliveryReports()
+
+	return producer, nil
 }
 
-// Обработчик сообщений в kafka.
+// Отправляет сообщение без ключа. В асинхронном режиме только ставит его в очередь,
+// ошибки доставки попадают в лог и метрики.
 func (p *Producer) Produce(msg string) error {
+	return p.ProduceMessage(Message{Value: []byte(msg)})
+}
+
+// Отправляет сообщение без ключа и ждет подтверждения брокера.
+func (p *Producer) ProduceSync(msg string) error {
+	return p.ProduceMessageSync(Message{Value: []byte(msg)})
+}
+
+// Отправляет сообщение с ключом и заголовками, в асинхронном режиме не ждет подтверждения.
+func (p *Producer) ProduceMessage(msg Message) error {
+	if p.async {
+		return p.enqueue(msg, nil)
+	}
+
+	return p.ProduceMessageSync(msg)
+}
+
+// Отправляет сообщение с ключом и заголовками и ждет подтверждения брокера.
+func (p *Producer) ProduceMessageSync(msg Message) error {
+	delivered := make(chan error, 1)
+
+	if err := p.enqueue(msg, delivered); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-delivered:
+		return err
+	case <-p.done:
+		return ErrProducerClosed
+	}
+}
+
+// Отправляет сообщения пачкой и ждет отчетов о доставке всех сообщений.
+// Возвращает ошибки доставки в порядке msgs, nil - сообщение доставлено. Если
+// сообщение не удалось поставить в очередь, следующие не отправляются, чтобы
+// не нарушить порядок, и получают ту же ошибку.
+func (p *Producer) ProduceMessages(msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	reports := make([]chan error, 0, len(msgs))
+
+	for i, msg := range msgs {
+		delivered := make(chan error, 1)
+
+		if err := p.enqueue(msg, delivered); err != nil {
+			for j := i; j < len(msgs); j++ {
+				errs[j] = err
+			}
+
+			break
+		}
+
+		reports = append(reports, delivered)
+	}
+
+	for i, delivered := range reports {
+		select {
+		case errs[i] = <-delivered:
+		case <-p.done:
+			errs[i] = ErrProducerClosed
+		}
+	}
+
+	return errs
+}
+
+// Ставит сообщение в очередь librdkafka, результат доставки передается в delivered, если он задан.
+func (p *Producer) enqueue(msg Message, delivered chan error) error {
+	topic := msg.Topic
+	if topic == "" {
+		topic = p.Topic
+	}
+
 	kafkaMsg := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{
-			Topic:     &p.Topic,
+			Topic:     &topic,
 			Partition: kafka.PartitionAny,
 		},
-		Value:     []byte(msg),
-		Key:       nil,
+		Value:     msg.Value,
+		Headers:   kafkaHeaders(msg.Headers),
 		Timestamp: time.Now(),
+		Opaque:    delivered,
 	}
-	kafkaChan := make(chan kafka.Event)
 
-	if err := p.Producer.Produce(kafkaMsg, kafkaChan); err != nil {
+	if msg.Key != "" {
+		kafkaMsg.Key = []byte(msg.Key)
+	}
+
+	// Отчет о доставке придет в общий канал Events
+	if err := p.Producer.Produce(kafkaMsg, nil); err != nil {
+		monitoring.KafkaProducerFailuresTotal.WithLabelValues(topic).Inc()
+
 		return fmt.Errorf("error sending message to kafka: %w", err)
 	}
 
-	e := <-kafkaChan
-	switch ev := e.(type) {
-	case *kafka.Message:
-		log.Printf("Message produced by Kafka: %s", ev.Value)
+	monitoring.KafkaProducerInFlight.WithLabelValues(topic).Inc()
 
+	return nil
+}
+
+// Заголовки в порядке ключей, чтобы одинаковые сообщения не отличались.
+func kafkaHeaders(headers map[string]string) []kafka.Header {
+	if len(headers) == 0 {
 		return nil
-	case kafka.Error:
-		log.Printf("Error produced by Kafka: %s", ev.String())
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	result := make([]kafka.Header, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, kafka.Header{Key: key, Value: []byte(headers[key])})
+	}
 
-		return ev
-	default:
-		return errUnknownType
+	return result
+}
+
+// Единственный обработчик отчетов о доставке, завершается при закрытии продюсера.
+func (p *Producer) handleDeliveryReports() {
+	defer close(p.done)
+
+	for e := range p.Producer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			topic := *ev.TopicPartition.Topic
+			monitoring.KafkaProducerInFlight.WithLabelValues(topic).Dec()
+
+			err := ev.TopicPartition.Error
+			if err != nil {
+				monitoring.KafkaProducerFailuresTotal.WithLabelValues(topic).Inc()
+				log.Printf("Error delivering message to Kafka: %v", err)
+			} else {
+				monitoring.KafkaProducerDeliveredTotal.WithLabelValues(topic).Inc()
+			}
+
+			if delivered, ok := ev.Opaque.(chan error); ok && delivered != nil {
+				delivered <- err
+			}
+		case kafka.Error:
+			log.Printf("Error produced by Kafka: %s", ev.String())
+		}
 	}
 }
 
 // Закрывает продюсер, после ожидания обработки непринятых сообщений.
 func (p *Producer) Close() {
-	log.Println("Closing Kafka producer connection...")
-	p.Producer.Flush(flushTimeout)
-	p.Producer.Close()
+	p.once.Do(func() {
+		log.Println("Closing Kafka producer connection...")
+
+		if remaining := p.Producer.Flush(flushTimeout); remaining > 0 {
+			log.Printf("%d Kafka messages were not delivered before shutdown", remaining)
+		}
+
+		p.Producer.Close()
+		<-p.done
+	})
 }
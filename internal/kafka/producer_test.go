@@ -0,0 +1,69 @@
+package kafka_test
+
+import (
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/kafka"
+	"Go-internship-Manifure/internal/monitoring"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testMessages(n int) []kafka.Message {
+	msgs := make([]kafka.Message, n)
+	for i := range msgs {
+		msgs[i] = kafka.Message{Key: "product-1", Value: []byte("event"), Headers: map[string]string{"event_type": "product.updated"}}
+	}
+
+	return msgs
+}
+
+func TestProducerDeliveryReports(t *testing.T) {
+	cluster, err := confluent.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	producer, err := kafka.NewProducer([]string{cluster.BootstrapServers()}, "delivered-events", kafka.DefaultProducerConfig())
+	require.NoError(t, err)
+	defer producer.Close()
+
+	delivered := testutil.ToFloat64(monitoring.KafkaProducerDeliveredTotal.WithLabelValues("delivered-events"))
+	failures := testutil.ToFloat64(monitoring.KafkaProducerFailuresTotal.WithLabelValues("delivered-events"))
+
+	// Пачка ждет отчетов о доставке всех сообщений
+	for _, err := range producer.ProduceMessages(testMessages(5)) {
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, producer.ProduceMessageSync(kafka.Message{Key: "product-2", Value: []byte("event")}))
+
+	require.Zero(t, testutil.ToFloat64(monitoring.KafkaProducerInFlight.WithLabelValues("delivered-events")))
+	require.Equal(t, delivered+6, testutil.ToFloat64(monitoring.KafkaProducerDeliveredTotal.WithLabelValues("delivered-events")))
+	require.Equal(t, failures, testutil.ToFloat64(monitoring.KafkaProducerFailuresTotal.WithLabelValues("delivered-events")))
+}
+
+func TestProducerDeliveryFailure(t *testing.T) {
+	cfg := kafka.DefaultProducerConfig()
+	cfg.DeliveryTimeout = 200 * time.Millisecond
+
+	// Брокер недоступен: по истечении срока доставки приходят отчеты об ошибке
+	producer, err := kafka.NewProducer([]string{"127.0.0.1:1"}, "failed-events", cfg)
+	require.NoError(t, err)
+	defer producer.Close()
+
+	failures := testutil.ToFloat64(monitoring.KafkaProducerFailuresTotal.WithLabelValues("failed-events"))
+
+	errs := producer.ProduceMessages(testMessages(3))
+	require.Len(t, errs, 3)
+
+	for _, err := range errs {
+		require.Error(t, err)
+	}
+
+	require.Error(t, producer.ProduceMessageSync(kafka.Message{Key: "product-2", Value: []byte("event")}))
+
+	require.Zero(t, testutil.ToFloat64(monitoring.KafkaProducerInFlight.WithLabelValues("failed-events")))
+	require.Equal(t, failures+4, testutil.ToFloat64(monitoring.KafkaProducerFailuresTotal.WithLabelValues("failed-events")))
+}
@@ -0,0 +1,145 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Lifecycle управляет фоновыми задачами и ресурсами сервиса. Компоненты
+// останавливаются в порядке, обратном регистрации, с общим сроком завершения,
+// поэтому регистрировать их нужно в порядке запуска.
+type Lifecycle struct {
+	timeout time.Duration
+
+	mu     sync.Mutex
+	stops  []stopStep
+	failed chan error
+}
+
+type stopStep struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// Создает lifecycle, timeout - общий срок остановки всех компонентов.
+func New(timeout time.Duration) *Lifecycle {
+	return &Lifecycle{
+		timeout: timeout,
+		failed:  make(chan error, 1),
+	}
+}
+
+// Регистрирует функцию остановки компонента.
+func (l *Lifecycle) OnStop(name string, stop func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stops = append(l.stops, stopStep{name: name, stop: stop})
+}
+
+// Запускает фоновую задачу. При остановке контекст задачи отменяется и
+// lifecycle ждет ее завершения. Ошибка задачи до остановки завершает сервис.
+func (l *Lifecycle) Go(name string, run func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := run(ctx); err != nil && ctx.Err() == nil {
+			l.fail(fmt.Errorf("%s: %w", name, err))
+		}
+	}()
+
+	l.OnStop(name, func(stopCtx context.Context) error {
+		cancel()
+
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return fmt.Errorf("did not stop in time: %w", stopCtx.Err())
+		}
+	})
+}
+
+// Запускает HTTP сервер. При остановке сервер перестает принимать соединения
+// и дожидается завершения текущих запросов.
+func (l *Lifecycle) Serve(name string, server *http.Server) {
+	l.Go(name, func(context.Context) error {
+		log.Printf("Starting %s on %s", name, server.Addr)
+
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+
+		return nil
+	})
+
+	l.OnStop(name, server.Shutdown)
+}
+
+// Ждет сигнала завершения или ошибки фоновой задачи и останавливает компоненты.
+func (l *Lifecycle) Run() error {
+	return errors.Join(l.Wait(), l.Shutdown())
+}
+
+// Ждет SIGINT/SIGTERM или ошибки фоновой задачи. Возвращает ошибку задачи.
+func (l *Lifecycle) Wait() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down gracefully...", sig)
+
+		return nil
+	case err := <-l.failed:
+		log.Printf("Shutting down after failure: %v", err)
+
+		return err
+	}
+}
+
+// Останавливает компоненты в порядке, обратном регистрации. Если срок
+// остановки истек, оставшиеся компоненты закрываются без ожидания.
+func (l *Lifecycle) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	l.mu.Lock()
+	stops := l.stops
+	l.stops = nil
+	l.mu.Unlock()
+
+	var errs []error
+
+	for i := len(stops) - 1; i >= 0; i-- {
+		step := stops[i]
+
+		log.Printf("Stopping %s...", step.name)
+
+		if err := step.stop(ctx); err != nil {
+			log.Printf("Failed to stop %s: %v", step.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *Lifecycle) fail(err error) {
+	select {
+	case l.failed <- err:
+	default:
+	}
+}
@@ -0,0 +1,71 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/lifecycle"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownStopsInReverseOrder(t *testing.T) {
+	app := lifecycle.New(time.Second)
+
+	var stopped []string
+
+	app.OnStop("database", func(context.Context) error {
+		stopped = append(stopped, "database")
+
+		return nil
+	})
+
+	// Задача дожидается отмены контекста и завершает обработку до закрытия базы
+	app.Go("consumer", func(ctx context.Context) error {
+		<-ctx.Done()
+		stopped = append(stopped, "consumer")
+
+		return nil
+	})
+
+	app.Serve("HTTP server", &http.Server{Addr: "127.0.0.1:0"})
+
+	require.NoError(t, app.Shutdown())
+	require.Equal(t, []string{"consumer", "database"}, stopped)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	app := lifecycle.New(50 * time.Millisecond)
+
+	closed := false
+	app.OnStop("database", func(context.Context) error {
+		closed = true
+
+		return nil
+	})
+
+	// Задача не реагирует на отмену, остальные компоненты все равно закрываются
+	release := make(chan struct{})
+	defer close(release)
+
+	app.Go("stuck", func(context.Context) error {
+		<-release
+
+		return nil
+	})
+
+	err := app.Shutdown()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, closed)
+}
+
+func TestFailedTaskStopsService(t *testing.T) {
+	app := lifecycle.New(time.Second)
+
+	errListen := errors.New("address already in use")
+	app.Go("HTTP server", func(context.Context) error { return errListen })
+
+	require.ErrorIs(t, app.Run(), errListen)
+}
@@ -0,0 +1,416 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Таблица примененных миграций, общая для сервисов одной схемы.
+const table = "schema_migrations"
+
+var ErrUnknownCommand = errors.New("unknown migrate command")
+
+// Миграция схемы из пары файлов <version>_<name>.up.sql и <version>_<name>.down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Состояние миграции в базе.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator применяет и откатывает миграции сервиса. Изменения выполняются
+// под advisory lock, поэтому несколько реплик не применяют миграции одновременно.
+type Migrator struct {
+	conn       *gorm.DB
+	service    string
+	migrations []Migration
+}
+
+// Создает migrator для миграций сервиса service из корня fsys.
+func New(conn *gorm.DB, service string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{conn: conn, service: service, migrations: migrations}, nil
+}
+
+// Читает миграции из корня fsys, упорядоченные по версии. У каждой миграции
+// должны быть оба файла, версии не должны повторяться.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, file := range files {
+		base := path.Base(file)
+
+		var direction string
+
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("invalid migration file name %s: expected .up.sql or .down.sql", base)
+		}
+
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid migration file name %s: expected <version>_<name>", base)
+		}
+
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", base)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", base, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Последняя версия среди миграций сервиса, 0 - миграций нет.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Применяет все непримененные миграции.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Откатывает последнюю примененную миграцию.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.revert(ctx, conn, m.migrations[i])
+			}
+		}
+
+		log.Printf("No %s migrations to roll back", m.service)
+
+		return nil
+	})
+}
+
+// Приводит схему к версии version: применяет миграции до нее включительно
+// и откатывает более поздние. 0 откатывает все миграции.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("unknown %s migration version %d", m.service, version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// Сначала откат более поздних миграций в обратном порядке
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; ok && migration.Version > version {
+				if err := m.revert(ctx, conn, migration); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; !ok && migration.Version <= version {
+				if err := m.apply(ctx, conn, migration); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Состояние всех миграций сервиса.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			appliedAt, ok := applied[migration.Version]
+			statuses = append(statuses, Status{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Выполняет команду migrate: up, down, status или to <version>. Результат
+// команды status выводится в out.
+func (m *Migrator) Run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected up, down, status or to <version>", ErrUnknownCommand)
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx)
+	case "to":
+		if len(args) != 2 {
+			return errors.New("usage: migrate to <version>")
+		}
+
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration version %q: %w", args[1], err)
+		}
+
+		return m.To(ctx, version)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+
+		return w.Flush()
+	default:
+		return fmt.Errorf("%w %q: expected up, down, status or to <version>", ErrUnknownCommand, args[0])
+	}
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Выполняет fn на отдельном соединении под advisory lock сервиса. Блокировка
+// принадлежит сессии, поэтому все запросы выполняются через это соединение.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	sqlDB, err := m.conn.DB()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve *sql.DB: %w", err)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	// SQLite не поддерживает advisory lock, запись в нем и так выполняется одним соединением
+	if m.conn.Dialector.Name() == "postgres" {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockKey()); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+
+		defer func() {
+			// Контекст мог быть отменен, блокировку все равно нужно снять
+			if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", m.lockKey()); err != nil {
+				log.Printf("Failed to release %s migration lock: %v", m.service, err)
+			}
+		}()
+	}
+
+	create := `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		service    TEXT NOT NULL,
+		version    BIGINT NOT NULL,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL, -- UTC
+		PRIMARY KEY (service, version)
+	)`
+	if _, err := conn.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("failed to create %s table: %w", table, err)
+	}
+
+	return fn(conn)
+}
+
+// Ключ advisory lock, одинаковый у всех реплик сервиса.
+func (m *Migrator) lockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(table + ":" + m.service))
+
+	return int64(h.Sum64())
+}
+
+// Версии примененных миграций и время их применения.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM "+table+" WHERE service = $1", m.service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Применяет миграцию и отмечает ее в одной транзакции.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	err := inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO "+table+" (service, version, name, applied_at) VALUES ($1, $2, $3, $4)",
+			m.service, migration.Version, migration.Name, time.Now().UTC())
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	log.Printf("Applied %s migration %d_%s", m.service, migration.Version, migration.Name)
+
+	return nil
+}
+
+// Откатывает миграцию и удаляет отметку о ней в одной транзакции.
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	err := inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE service = $1 AND version = $2", m.service, migration.Version)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to roll back migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	log.Printf("Rolled back %s migration %d_%s", m.service, migration.Version, migration.Name)
+
+	return nil
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,147 @@
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"Go-internship-Manifure/internal/migrate"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_create_items.up.sql":   {Data: []byte("CREATE TABLE items (id TEXT PRIMARY KEY);")},
+	"0001_create_items.down.sql": {Data: []byte("DROP TABLE items;")},
+	"0002_add_score.up.sql": {Data: []byte(`ALTER TABLE items ADD COLUMN score BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX idx_items_score ON items (score);`)},
+	"0002_add_score.down.sql": {Data: []byte("DROP INDEX idx_items_score;\nALTER TABLE items DROP COLUMN score;")},
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	return db
+}
+
+func appliedVersions(t *testing.T, m *migrate.Migrator) []int64 {
+	t.Helper()
+
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+
+	var versions []int64
+
+	for _, s := range statuses {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+
+	return versions
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	m, err := migrate.New(db, "catalog", testMigrations)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, m.Latest())
+
+	require.NoError(t, m.Up(ctx))
+	require.Equal(t, []int64{1, 2}, appliedVersions(t, m))
+	require.NoError(t, db.Exec("INSERT INTO items (id, score) VALUES ('a', 1)").Error)
+
+	// Повторный запуск ничего не делает
+	require.NoError(t, m.Up(ctx))
+
+	// Миграции другого сервиса учитываются отдельно
+	other, err := migrate.New(db, "orders", fstest.MapFS{
+		"0001_create_orders.up.sql":   {Data: []byte("CREATE TABLE orders (id TEXT PRIMARY KEY);")},
+		"0001_create_orders.down.sql": {Data: []byte("DROP TABLE orders;")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, other.Up(ctx))
+	require.Equal(t, []int64{1}, appliedVersions(t, other))
+
+	require.NoError(t, m.Down(ctx))
+	require.Equal(t, []int64{1}, appliedVersions(t, m))
+	require.Error(t, db.Exec("INSERT INTO items (id, score) VALUES ('b', 1)").Error)
+
+	require.NoError(t, m.To(ctx, 0))
+	require.Empty(t, appliedVersions(t, m))
+	require.True(t, db.Migrator().HasTable("orders"))
+	require.False(t, db.Migrator().HasTable("items"))
+
+	require.NoError(t, m.To(ctx, 2))
+	require.Equal(t, []int64{1, 2}, appliedVersions(t, m))
+
+	require.Error(t, m.To(ctx, 3))
+}
+
+func TestMigrationFailureIsRolledBack(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	m, err := migrate.New(db, "catalog", fstest.MapFS{
+		"0001_broken.up.sql":   {Data: []byte("CREATE TABLE items (id TEXT PRIMARY KEY);\nINSERT INTO missing VALUES (1);")},
+		"0001_broken.down.sql": {Data: []byte("DROP TABLE items;")},
+	})
+	require.NoError(t, err)
+
+	require.Error(t, m.Up(ctx))
+	require.Empty(t, appliedVersions(t, m))
+	require.False(t, db.Migrator().HasTable("items"))
+}
+
+func TestLoadRejectsInvalidMigrations(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_init.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"duplicate version": {
+			"0001_init.up.sql":    {Data: []byte("SELECT 1;")},
+			"0001_init.down.sql":  {Data: []byte("SELECT 1;")},
+			"0001_other.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_other.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"invalid name": {
+			"init.up.sql":   {Data: []byte("SELECT 1;")},
+			"init.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := migrate.Load(fsys)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	m, err := migrate.New(setupTestDB(t), "catalog", testMigrations)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Run(ctx, []string{"to", "1"}, nil))
+
+	var out bytes.Buffer
+	require.NoError(t, m.Run(ctx, []string{"status"}, &out))
+	require.Contains(t, out.String(), "create_items")
+	require.Contains(t, out.String(), "pending")
+
+	require.ErrorIs(t, m.Run(ctx, []string{"redo"}, nil), migrate.ErrUnknownCommand)
+	require.Error(t, m.Run(ctx, []string{"to", "latest"}, nil))
+}
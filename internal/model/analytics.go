@@ -7,3 +7,7 @@ type ProductUpdateAnalytics struct {
 type UserUpdateAnalytics struct {
 	ID string `json:"id" validate:"required,uuid"` // Поле ID обязательно и должно быть UUID
 }
+
+type CartUpdateAnalytics struct {
+	UserID string `json:"user_id" validate:"required,uuid"` // Поле UserID обязательно и должно быть UUID
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Версия схемы событий, увеличивается при несовместимых изменениях payload.
+const EventSchemaVersion = 1
+
+// Типы событий.
+const (
+	UserRegistered  = "user.registered"
+	UserUpdated     = "user.updated"
+	CartItemAdded   = "cart.item_added"
+	CartItemRemoved = "cart.item_removed"
+	ProductCreated  = "product.created"
+	ProductUpdated  = "product.updated"
+	ProductDeleted  = "product.deleted"
+)
+
+var (
+	ErrInvalidEvent             = errors.New("invalid event")
+	ErrUnsupportedSchemaVersion = errors.New("unsupported event schema version")
+)
+
+// Конверт, в котором передаются все сообщения kafka.
+type Event struct {
+	EventID       string          `json:"event_id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Producer      string          `json:"producer"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// Создает событие указанного типа, payload сериализуется в JSON.
+func NewEvent(eventType, producer string, payload any) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	return &Event{
+		EventID:       uuid.New().String(),
+		Type:          eventType,
+		SchemaVersion: EventSchemaVersion,
+		OccurredAt:    time.Now().UTC(),
+		Producer:      producer,
+		Payload:       data,
+	}, nil
+}
+
+// Разбирает сообщение kafka и проверяет версию схемы.
+func ParseEvent(message []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(message, &event); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+	}
+
+	if event.Type == "" || event.EventID == "" {
+		return nil, fmt.Errorf("%w: event id and type are required", ErrInvalidEvent)
+	}
+
+	if event.SchemaVersion < 1 || event.SchemaVersion > EventSchemaVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedSchemaVersion, event.SchemaVersion)
+	}
+
+	return &event, nil
+}
@@ -1,8 +1,25 @@
 package model
 
+import "time"
+
 type Recommendations struct {
 	ID              string  `gorm:"primary_key"`
 	Name            string  `gorm:"not null"`
 	Price           float32 `gorm:"default:0"`
-	PopularityScore int     `gorm:"not null"`
+	PopularityScore int     `gorm:"not null"` // Число событий о продукте без затухания
+
+	// Популярность с затуханием. В базе хранится в масштабе PopularityEpoch,
+	// в ответах API - текущее значение
+	Score float64 `gorm:"not null;default:0"`
+}
+
+// Момент времени, к которому приведены хранимые значения Recommendations.Score.
+// Таблица содержит одну строку.
+type PopularityEpoch struct {
+	ID    int       `gorm:"primaryKey"`
+	Epoch time.Time `gorm:"not null"`
+}
+
+func (PopularityEpoch) TableName() string {
+	return "popularity_epoch"
 }
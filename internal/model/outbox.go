@@ -0,0 +1,46 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Сообщение, ожидающее отправки в kafka. Пустой Payload означает tombstone.
+type OutboxMessage struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	Key       string `gorm:"not null"`
+	Payload   []byte
+	Headers   map[string]string `gorm:"serializer:json"`
+	CreatedAt time.Time         `gorm:"not null"`
+	SentAt    *time.Time
+	Attempts  int `gorm:"not null;default:0"`
+	LastError string
+}
+
+// Создает сообщение outbox с событием, key - id сущности. Тип события
+// дублируется в заголовках, чтобы его можно было прочитать без разбора payload.
+func NewOutboxMessage(key string, event *Event) (OutboxMessage, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return OutboxMessage{}, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	headers := map[string]string{
+		"event_id":   event.EventID,
+		"event_type": event.Type,
+		"producer":   event.Producer,
+	}
+
+	return OutboxMessage{Key: key, Payload: payload, Headers: headers}, nil
+}
+
+// Создает tombstone для сущности с указанным id.
+func NewOutboxTombstone(key string) OutboxMessage {
+	return OutboxMessage{Key: key}
+}
+
+// Признак tombstone: сообщение без значения.
+func (m *OutboxMessage) IsTombstone() bool {
+	return len(m.Payload) == 0
+}
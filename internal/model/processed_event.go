@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Событие, обработанное сервисом. Запись добавляется в транзакции обработки,
+// поэтому повторная доставка того же события пропускается.
+type ProcessedEvent struct {
+	EventID     string    `gorm:"primaryKey"`
+	Type        string    `gorm:"not null"`
+	ProcessedAt time.Time `gorm:"not null"`
+}
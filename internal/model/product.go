@@ -1,8 +1,20 @@
 package model
 
 type Product struct {
-	ID    string  `json:"id"`
-	Name  string  `json:"name"`
-	Price float32 `json:"price"`
-	Views int64   `json:"views"`
+	ID    string  `json:"id" gorm:"primaryKey"`
+	Name  string  `json:"name" gorm:"not null"`
+	Price float32 `json:"price" gorm:"default:0"`
+	Views int64   `json:"views" gorm:"default:0"`
+}
+
+// Сообщение об изменении продукта с id пользователя, который его выполнил.
+type ProductEvent struct {
+	Product
+	UpdatedBy string `json:"updated_by"`
+}
+
+// Payload события ProductDeleted.
+type ProductDeletedEvent struct {
+	ID        string `json:"id"`
+	DeletedBy string `json:"deleted_by"`
 }
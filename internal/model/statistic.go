@@ -1,8 +1,11 @@
 package model
 
+import "gorm.io/gorm"
+
 type ProductStatistics struct {
-	ProductID   string `gorm:"primaryKey"`
-	UpdateCount int    `gorm:"default:0"`
+	ProductID   string         `gorm:"primaryKey"`
+	UpdateCount int            `gorm:"default:0"`
+	DeletedAt   gorm.DeletedAt `gorm:"index"` // Статистика удаленного продукта сохраняется
 }
 
 type UserStatistics struct {
@@ -1,11 +1,22 @@
 package model
 
 type User struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Cart     []struct {
-		ProductID string `json:"product_id"`
-	} `json:"cart"`
+	ID           string     `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"not null"`
+	Email        string     `json:"email" gorm:"uniqueIndex;not null"`
+	PasswordHash string     `json:"-" gorm:"not null"` // никогда не попадает в ответы и сообщения kafka
+	Role         string     `json:"role" gorm:"not null;default:user"`
+	Cart         []CartItem `json:"cart" gorm:"serializer:json"`
+}
+
+type CartItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Payload событий CartItemAdded и CartItemRemoved.
+type CartEvent struct {
+	UserID    string `json:"user_id"`
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
 }
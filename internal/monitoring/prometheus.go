@@ -1,10 +1,13 @@
 package monitoring
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -45,6 +48,82 @@ var (
 		[]string{"topic"},
 	)
 
+	KafkaDeadLetterMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_dead_letter_messages_total",
+			Help: "Total number of Kafka messages sent to a dead letter topic",
+		},
+		[]string{"topic", "reason"},
+	)
+
+	// Метрики продюсера Kafka.
+	KafkaProducerInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_producer_in_flight_messages",
+			Help: "Number of Kafka messages waiting for a delivery report",
+		},
+		[]string{"topic"},
+	)
+
+	KafkaProducerDeliveredTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_producer_delivered_total",
+			Help: "Total number of Kafka messages confirmed by the broker",
+		},
+		[]string{"topic"},
+	)
+
+	KafkaProducerFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_producer_failures_total",
+			Help: "Total number of Kafka messages that failed to be produced",
+		},
+		[]string{"topic"},
+	)
+
+	// Возраст самого старого неотправленного сообщения outbox.
+	OutboxLagSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "outbox_lag_seconds",
+			Help: "Age of the oldest unsent outbox message",
+		},
+		[]string{"outbox"},
+	)
+
+	// Готовность сервиса и результаты проверок зависимостей.
+	ServiceReady = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "service_ready",
+			Help: "Whether all readiness checks of the service passed (1) or not (0)",
+		},
+	)
+
+	ReadinessCheckStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "readiness_check_status",
+			Help: "Result of the last readiness check of a dependency: 1 - up, 0 - down",
+		},
+		[]string{"check"},
+	)
+
+	// Доступность зависимости по результатам подключения и обращений к ней.
+	DependencyUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dependency_up",
+			Help: "Whether the last access to a dependency succeeded (1) or failed (0)",
+		},
+		[]string{"dependency"},
+	)
+
+	// Повторно доставленные события, пропущенные по журналу обработанных событий.
+	DuplicateEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "duplicate_events_total",
+			Help: "Total number of redelivered events skipped by the processed events ledger",
+		},
+		[]string{"ledger"},
+	)
+
 	// Redis метрики.
 	RedisRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -69,10 +148,32 @@ func Init() {
 	prometheus.MustRegister(HTTPRequestDuration)
 	prometheus.MustRegister(KafkaMessagesConsumedTotal)
 	prometheus.MustRegister(KafkaMessageProcessingDuration)
+	prometheus.MustRegister(KafkaDeadLetterMessagesTotal)
+	prometheus.MustRegister(KafkaProducerInFlight)
+	prometheus.MustRegister(KafkaProducerDeliveredTotal)
+	prometheus.MustRegister(KafkaProducerFailuresTotal)
+	prometheus.MustRegister(OutboxLagSeconds)
+	prometheus.MustRegister(DuplicateEventsTotal)
+	prometheus.MustRegister(ServiceReady)
+	prometheus.MustRegister(ReadinessCheckStatus)
+	prometheus.MustRegister(DependencyUp)
 	prometheus.MustRegister(RedisRequestsTotal)
 	prometheus.MustRegister(RedisRequestDuration)
 }
 
+// Публикует статистику пула соединений базы с меткой db_name: открытые и
+// простаивающие соединения, число и длительность ожидания свободного соединения.
+func RegisterDBStats(dbName string, db *sql.DB) error {
+	err := prometheus.Register(collectors.NewDBStatsCollector(db, dbName))
+
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return nil
+	}
+
+	return err
+}
+
 // Middleware для мониторинга HTTP запросов.
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -3,6 +3,7 @@ package redis
 import (
 	"errors"
 	"log"
+	"strings"
 	"sync"
 	"time"
 )
@@ -50,6 +51,37 @@ func (c *CacheMock) Set(key string, value string, ttl time.Duration) error {
 	return nil
 }
 
+// SetNX сохраняет значение, только если ключ отсутствует или истек.
+func (c *CacheMock) SetNX(key string, value string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, exists := c.store[key]; exists && time.Now().Before(item.expiration) {
+		return false, nil
+	}
+
+	c.store[key] = cacheItem{
+		value:      value,
+		expiration: time.Now().Add(ttl),
+	}
+
+	return true, nil
+}
+
+// DeletePrefix удаляет все ключи с указанным префиксом.
+func (c *CacheMock) DeletePrefix(prefix string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.store {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.store, key)
+		}
+	}
+
+	return nil
+}
+
 // Close завершает работу мока Redis и очищает его состояние.
 func (c *CacheMock) Close() error {
 	c.mu.Lock()
@@ -4,6 +4,7 @@ import (
 	"Go-internship-Manifure/internal/monitoring"
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
@@ -13,11 +14,15 @@ import (
 const (
 	successStatus = "success"
 	errStatus     = "error"
+
+	scanCount = 100 // Количество ключей за одну итерацию SCAN
 )
 
 type CacheInterface interface {
 	Get(key string) (string, error)
 	Set(key string, value string, ttl time.Duration) error
+	SetNX(key string, value string, ttl time.Duration) (bool, error)
+	DeletePrefix(prefix string) error
 	Close() error
 }
 
@@ -27,8 +32,8 @@ type Cache struct {
 
 var ctx = context.Background()
 
-// Подключение к redis.
-func NewCache(address, password string, db int) *Cache {
+// Подключение к redis. Возвращает ошибку, если redis не отвечает.
+func NewCache(ctx context.Context, address, password string, db int) (*Cache, error) {
 	client := redis.NewClient(&redis.Options{
 		Addr:     address,
 		Password: password,
@@ -37,12 +42,14 @@ func NewCache(address, password string, db int) *Cache {
 
 	res, err := client.Ping(ctx).Result()
 	if err != nil {
-		log.Fatalf("Error connecting to redis: %s, %s", res, err)
+		_ = client.Close()
+
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
 	log.Printf("Connected to redis: %s", res)
 
-	return &Cache{Client: client}
+	return &Cache{Client: client}, nil
 }
 
 // Получает ключ и проверяет, существует ли он в Redis.
@@ -99,6 +106,59 @@ func (c *Cache) Set(key, value string, ttl time.Duration) error {
 	return err
 }
 
+// Устанавливает ключ, только если он еще не существует.
+func (c *Cache) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	log.Printf("SetNX redis key: %s", key)
+
+	start := time.Now()
+
+	ok, err := c.Client.SetNX(ctx, key, value, ttl).Result()
+	duration := time.Since(start).Seconds()
+
+	status := successStatus
+	if err != nil {
+		status = errStatus
+	}
+
+	// обновление метрик.
+	monitoring.RedisRequestsTotal.WithLabelValues("setnx", status).Inc()
+	monitoring.RedisRequestDuration.WithLabelValues("setnx").Observe(duration)
+
+	return ok, err
+}
+
+// Удаляет все ключи с указанным префиксом, ключи перебираются через SCAN.
+func (c *Cache) DeletePrefix(prefix string) error {
+	log.Printf("Delete redis keys with prefix: %s", prefix)
+
+	start := time.Now()
+
+	var keys []string
+
+	iter := c.Client.Scan(ctx, 0, prefix+"*", scanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+
+	err := iter.Err()
+	if err == nil && len(keys) > 0 {
+		err = c.Client.Del(ctx, keys...).Err()
+	}
+
+	duration := time.Since(start).Seconds()
+
+	status := successStatus
+	if err != nil {
+		status = errStatus
+	}
+
+	// обновление метрик.
+	monitoring.RedisRequestsTotal.WithLabelValues("delete", status).Inc()
+	monitoring.RedisRequestDuration.WithLabelValues("delete").Observe(duration)
+
+	return err
+}
+
 func (c *Cache) Close() error {
 	log.Println("Closing Redis connection...")
 	if c.Client == nil {
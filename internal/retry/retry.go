@@ -0,0 +1,55 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Политика повторов с экспоненциальной задержкой.
+type Policy struct {
+	MaxAttempts    int           // Общее число попыток, включая первую
+	InitialBackoff time.Duration // Задержка перед первым повтором, далее удваивается
+	MaxBackoff     time.Duration
+}
+
+// Задержка перед попыткой attempt (начиная со второй).
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 2; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, p.MaxBackoff)
+}
+
+// Вызывает fn, пока она не завершится успешно, не закончатся попытки или не
+// будет отменен контекст. onError вызывается после каждой неудачной попытки
+// и может быть nil. Возвращает ошибку последней попытки.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error, onError func(attempt int, err error)) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+
+		if onError != nil {
+			onError(attempt, err)
+		}
+
+		if attempt >= p.MaxAttempts {
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+
+		timer := time.NewTimer(p.Backoff(attempt + 1))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
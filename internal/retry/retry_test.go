@@ -0,0 +1,67 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Go-internship-Manifure/internal/retry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	p := retry.Policy{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	require.Equal(t, 100*time.Millisecond, p.Backoff(2))
+	require.Equal(t, 200*time.Millisecond, p.Backoff(3))
+	require.Equal(t, 800*time.Millisecond, p.Backoff(5))
+	require.Equal(t, time.Second, p.Backoff(6))
+	require.Equal(t, time.Second, p.Backoff(50))
+}
+
+func TestDo(t *testing.T) {
+	p := retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	errRefused := errors.New("connection refused")
+
+	// Успех с третьей попытки
+	calls := 0
+	var failed []int
+
+	err := retry.Do(context.Background(), p, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errRefused
+		}
+
+		return nil
+	}, func(attempt int, _ error) { failed = append(failed, attempt) })
+
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, failed)
+
+	// Попытки закончились
+	calls = 0
+	err = retry.Do(context.Background(), p, func(context.Context) error {
+		calls++
+
+		return errRefused
+	}, nil)
+
+	require.ErrorIs(t, err, errRefused)
+	require.Equal(t, 3, calls)
+}
+
+func TestDoCanceled(t *testing.T) {
+	p := retry.Policy{MaxAttempts: 100, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := retry.Do(ctx, p, func(context.Context) error {
+		cancel()
+
+		return errors.New("connection refused")
+	}, nil)
+
+	require.ErrorIs(t, err, context.Canceled)
+}